@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Nagios plugin exit codes.
+const (
+	checkOK = iota
+	checkWarning
+	checkCritical
+	checkUnknown
+)
+
+var checkStatusNames = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+var (
+	thresholdReg = regexp.MustCompile(`^\s*([a-zA-Z_:][a-zA-Z0-9_:]*)\s*(\{[^}]*\})?\s*(>=|<=|==|!=|>|<)\s*(\S+)\s*$`)
+	matcherReg   = regexp.MustCompile(`^\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*=\s*"([^"]*)"\s*$`)
+)
+
+// stringsFlag collects repeated string flags.
+type stringsFlag []string
+
+// String implements flag.Value.
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ", ")
+}
+
+// Set implements flag.Value.
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// threshold is a condition like servfail_ratio>0.01 or
+// bind_resolver_stats_query_timeouts_total{view="internal"}>=100.
+type threshold struct {
+	expr     string
+	name     string
+	matchers map[string]string
+	op       string
+	value    float64
+}
+
+func parseThreshold(expr string) (*threshold, error) {
+	m := thresholdReg.FindStringSubmatch(expr)
+	if m == nil {
+		return nil, fmt.Errorf("Threshold %q is not in metric{label=\"value\"}>number form", expr)
+	}
+	value, err := strconv.ParseFloat(m[4], 64)
+	if err != nil {
+		return nil, fmt.Errorf("Threshold %q has an invalid value: %s", expr, err)
+	}
+	t := &threshold{expr: expr, name: m[1], matchers: map[string]string{}, op: m[3], value: value}
+	if m[2] != "" {
+		for _, matcher := range strings.Split(strings.Trim(m[2], "{}"), ",") {
+			if strings.TrimSpace(matcher) == "" {
+				continue
+			}
+			lm := matcherReg.FindStringSubmatch(matcher)
+			if lm == nil {
+				return nil, fmt.Errorf("Threshold %q has an invalid label matcher %q", expr, matcher)
+			}
+			t.matchers[lm[1]] = lm[2]
+		}
+	}
+	return t, nil
+}
+
+func (t *threshold) violated(v float64) bool {
+	switch t.op {
+	case ">":
+		return v > t.value
+	case ">=":
+		return v >= t.value
+	case "<":
+		return v < t.value
+	case "<=":
+		return v <= t.value
+	case "==":
+		return v == t.value
+	default:
+		return v != t.value
+	}
+}
+
+// nagiosRange renders the threshold in the perfdata range syntax where
+// possible.
+func (t *threshold) nagiosRange() string {
+	switch t.op {
+	case ">", ">=":
+		return plainFloat(t.value)
+	case "<", "<=":
+		return plainFloat(t.value) + ":"
+	}
+	return ""
+}
+
+// plainFloat formats without exponent, which perfdata parsers don't accept.
+func plainFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// checkSeries is one sample a threshold applies to.
+type checkSeries struct {
+	label string
+	value float64
+}
+
+// findSeries returns the samples matching the threshold. Names may leave out
+// the bind_ or bind_derived_ prefix, so servfail_ratio finds
+// bind_derived_servfail_ratio.
+func (t *threshold) findSeries(mfs []*dto.MetricFamily) []checkSeries {
+	byName := map[string]*dto.MetricFamily{}
+	for _, mf := range mfs {
+		byName[mf.GetName()] = mf
+	}
+	var mf *dto.MetricFamily
+	for _, name := range []string{t.name, namespace + "_" + t.name, namespace + "_" + DERIVED + "_" + t.name} {
+		if mf = byName[name]; mf != nil {
+			break
+		}
+	}
+	if mf == nil {
+		return nil
+	}
+	var series []checkSeries
+	for _, m := range mf.GetMetric() {
+		labels := map[string]string{}
+		var values []string
+		for _, l := range m.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+			values = append(values, l.GetValue())
+		}
+		matched := true
+		for name, value := range t.matchers {
+			if labels[name] != value {
+				matched = false
+			}
+		}
+		if !matched {
+			continue
+		}
+		var value float64
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			value = m.GetCounter().GetValue()
+		case dto.MetricType_GAUGE:
+			value = m.GetGauge().GetValue()
+		case dto.MetricType_UNTYPED:
+			value = m.GetUntyped().GetValue()
+		case dto.MetricType_HISTOGRAM:
+			value = float64(m.GetHistogram().GetSampleCount())
+		case dto.MetricType_SUMMARY:
+			value = float64(m.GetSummary().GetSampleCount())
+		}
+		label := t.name
+		if len(values) > 0 {
+			label += "[" + strings.Join(values, ",") + "]"
+		}
+		series = append(series, checkSeries{label: label, value: value})
+	}
+	return series
+}
+
+// evaluateThresholds compares the gathered metrics against the thresholds
+// and returns the plugin status, the problems found and the perfdata.
+func evaluateThresholds(mfs []*dto.MetricFamily, warn, crit []*threshold) (int, []string, []string) {
+	status := checkOK
+	var problems []string
+	perf := map[string]string{}
+	ranges := map[string][2]string{}
+	raise := func(s int) {
+		// CRITICAL beats WARNING beats UNKNOWN.
+		rank := map[int]int{checkOK: 0, checkUnknown: 1, checkWarning: 2, checkCritical: 3}
+		if rank[s] > rank[status] {
+			status = s
+		}
+	}
+	for i, thresholds := range [][]*threshold{warn, crit} {
+		level := checkWarning
+		if i == 1 {
+			level = checkCritical
+		}
+		for _, t := range thresholds {
+			series := t.findSeries(mfs)
+			if len(series) == 0 {
+				raise(checkUnknown)
+				problems = append(problems, "no data for "+t.expr)
+				continue
+			}
+			for _, s := range series {
+				r := ranges[s.label]
+				r[i] = t.nagiosRange()
+				ranges[s.label] = r
+				perf[s.label] = plainFloat(s.value)
+				if t.violated(s.value) {
+					raise(level)
+					problems = append(problems, fmt.Sprintf("%s=%s (%s %s %s)",
+						s.label, plainFloat(s.value), checkStatusNames[level], t.op, plainFloat(t.value)))
+				}
+			}
+		}
+	}
+	labels := make([]string, 0, len(perf))
+	for label := range perf {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	perfdata := make([]string, 0, len(labels))
+	for _, label := range labels {
+		perfdata = append(perfdata, fmt.Sprintf("'%s'=%s;%s;%s", label, perf[label], ranges[label][0], ranges[label][1]))
+	}
+	return status, problems, perfdata
+}
+
+// loadSnapshot reads a dump saved by saveSnapshot. A missing file is not an
+// error, there is just no previous dump yet.
+func loadSnapshot(path string) (*StatusInfo, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	statsInfo := &StatusInfo{}
+	if err := json.Unmarshal(content, statsInfo); err != nil {
+		return nil, fmt.Errorf("Can't parse state file %s: %s", path, err)
+	}
+	return statsInfo, nil
+}
+
+func saveSnapshot(path string, statsInfo *StatusInfo) error {
+	content, err := json.Marshal(statsInfo)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, content)
+}
+
+// runCheck implements the check subcommand, a Nagios/Icinga plugin that
+// triggers a dump and compares it against thresholds.
+func runCheck(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	var (
+		bindSh    = fs.String("bind.sh", "./stats.sh", "Path name of shell.")
+		bindStats = fs.String("bind.stats-file", "/var/named/data/named_stats.txt", "Path name of the status statistics file output by Bind DNS.")
+		stateFile = fs.String("state-file", "/var/tmp/bind_stats_exporter.check.json", "File keeping the previous dump to compute derived ratios from.")
+		warnExprs stringsFlag
+		critExprs stringsFlag
+	)
+	fs.Var(&warnExprs, "warn", "Warning threshold like 'servfail_ratio>0.01', may be repeated.")
+	fs.Var(&critExprs, "crit", "Critical threshold like 'servfail_ratio>0.05', may be repeated.")
+	fs.SetOutput(out)
+	unknown := func(format string, a ...interface{}) int {
+		fmt.Fprintf(out, "BIND UNKNOWN - "+format+"\n", a...)
+		return checkUnknown
+	}
+	if err := fs.Parse(args); err != nil {
+		return checkUnknown
+	}
+	var warn, crit []*threshold
+	for i, exprs := range []stringsFlag{warnExprs, critExprs} {
+		for _, expr := range exprs {
+			t, err := parseThreshold(expr)
+			if err != nil {
+				return unknown("%s", err)
+			}
+			if i == 0 {
+				warn = append(warn, t)
+			} else {
+				crit = append(crit, t)
+			}
+		}
+	}
+
+	prev, err := loadSnapshot(*stateFile)
+	if err != nil {
+		return unknown("%s", err)
+	}
+	collector := NewStatsCollector(StatsCollectorOpts{
+		FilePath: *bindStats,
+		Script:   *bindSh,
+		Derived:  true,
+	})
+	collector.prev = prev
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	mfs, err := registry.Gather()
+	if err != nil {
+		return unknown("%s", err)
+	}
+	if upSeries := (&threshold{name: "up"}).findSeries(mfs); len(upSeries) == 0 || upSeries[0].value != 1 {
+		return unknown("statistics dump of %s failed", *bindStats)
+	}
+	if err := saveSnapshot(*stateFile, collector.prev); err != nil {
+		return unknown("can't save state: %s", err)
+	}
+
+	status, problems, perfdata := evaluateThresholds(mfs, warn, crit)
+	summary := strings.Join(problems, ", ")
+	if summary == "" {
+		summary = fmt.Sprintf("%d thresholds within limits", len(warn)+len(crit))
+	}
+	if prev == nil && status == checkUnknown {
+		summary += ", no previous dump in " + *stateFile + " yet"
+	}
+	fmt.Fprintf(out, "BIND %s - %s", checkStatusNames[status], summary)
+	if len(perfdata) > 0 {
+		fmt.Fprintf(out, " | %s", strings.Join(perfdata, " "))
+	}
+	fmt.Fprintln(out)
+	return status
+}
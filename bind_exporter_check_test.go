@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func Test_ParseThreshold(t *testing.T) {
+
+	th, err := parseThreshold(`bind_resolver_stats_query_timeouts_total{view="view_bj_ali"} >= 1e3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if th.name != "bind_resolver_stats_query_timeouts_total" || th.op != ">=" || th.value != 1000 ||
+		th.matchers["view"] != "view_bj_ali" {
+		t.Errorf("parsed %+v", th)
+	}
+	for _, expr := range []string{"servfail_ratio", "servfail_ratio>x", `up{view=x}>1`} {
+		if _, err := parseThreshold(expr); err == nil {
+			t.Errorf("expected an error for %q", expr)
+		}
+	}
+}
+
+func Test_EvaluateThresholds(t *testing.T) {
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&parsedStatsCollector{statsInfo: ParserStats(str)})
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parse := func(exprs ...string) []*threshold {
+		var thresholds []*threshold
+		for _, expr := range exprs {
+			th, err := parseThreshold(expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			thresholds = append(thresholds, th)
+		}
+		return thresholds
+	}
+
+	status, problems, perfdata := evaluateThresholds(mfs,
+		parse(`resolver_stats_query_timeouts_total{view="view_bj_mjq"}>1000000`),
+		parse(`resolver_stats_query_timeouts_total{view="view_bj_mjq"}>2000000`))
+	if status != checkWarning || len(problems) != 1 {
+		t.Errorf("status = %d, problems = %v", status, problems)
+	}
+	want := "'resolver_stats_query_timeouts_total[view_bj_mjq]'=1067167;1000000;2000000"
+	if len(perfdata) != 1 || perfdata[0] != want {
+		t.Errorf("perfdata = %v, want %s", perfdata, want)
+	}
+
+	status, _, _ = evaluateThresholds(mfs, nil, parse("incoming_queries_total<10"))
+	if status != checkCritical {
+		t.Errorf("status = %d, want critical", status)
+	}
+	status, problems, _ = evaluateThresholds(mfs, parse("servfail_ratio>0.01"), nil)
+	if status != checkUnknown || !strings.HasPrefix(problems[0], "no data") {
+		t.Errorf("status = %d, problems = %v", status, problems)
+	}
+}
+
+func Test_RunCheck(t *testing.T) {
+
+	dir := t.TempDir()
+	statsFile := filepath.Join(dir, "named.stats")
+	fixture := filepath.Join(dir, "fixture")
+	script := filepath.Join(dir, "stats.sh")
+	if err := ioutil.WriteFile(script, []byte("cp "+fixture+" "+statsFile+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{
+		"--bind.sh", script,
+		"--bind.stats-file", statsFile,
+		"--state-file", filepath.Join(dir, "state.json"),
+		"--warn", "servfail_ratio>0.01",
+		"--crit", "servfail_ratio>0.05",
+	}
+	run := func(dump string) (int, string) {
+		if err := ioutil.WriteFile(fixture, []byte(dump), 0644); err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		status := runCheck(args, &out)
+		return status, out.String()
+	}
+
+	if status, out := run(str); status != checkUnknown || !strings.Contains(out, "no previous dump") {
+		t.Errorf("first run: %d %s", status, out)
+	}
+	next := strings.NewReplacer(
+		"287491 queries resulted in SERVFAIL", "287591 queries resulted in SERVFAIL",
+		"2262987116 responses sent", "2262988116 responses sent",
+	).Replace(str)
+	status, out := run(next)
+	if status != checkCritical {
+		t.Errorf("second run: %d %s", status, out)
+	}
+	if !strings.HasPrefix(out, "BIND CRITICAL - servfail_ratio=0.1") ||
+		!strings.Contains(out, "| 'servfail_ratio'=0.1;0.01;0.05") {
+		t.Errorf("unexpected output %q", out)
+	}
+	if status, out := run(next); status != checkUnknown {
+		t.Errorf("third run without traffic: %d %s", status, out)
+	}
+}
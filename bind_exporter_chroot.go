@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultChroot is where the bind-chroot packages put named.
+const defaultChroot = "/var/named/chroot"
+
+// chrootPath maps a path as seen by a chrooted named to the path as seen by
+// the exporter. Relative paths and paths already below the chroot are kept.
+func chrootPath(chroot, p string) string {
+	if chroot == "" || chroot == "/" || p == "" || !filepath.IsAbs(p) {
+		return p
+	}
+	chroot = filepath.Clean(chroot)
+	if p == chroot || strings.HasPrefix(p, chroot+string(filepath.Separator)) {
+		return p
+	}
+	return filepath.Join(chroot, p)
+}
+
+// explainPath returns why path, resolved from orig, looks wrong, or "" if it
+// exists. Files named creates on demand, like the statistics file, only need
+// their directory to exist.
+func explainPath(kind, orig, path, chroot string, dirOnly bool) string {
+	target, origTarget := path, orig
+	if dirOnly {
+		target, origTarget = filepath.Dir(path), filepath.Dir(orig)
+	}
+	if _, err := os.Stat(target); err == nil {
+		return ""
+	}
+	msg := fmt.Sprintf("%s %s does not exist", kind, target)
+	if chroot == "" {
+		if candidate := chrootPath(defaultChroot, target); candidate != target && exists(candidate) {
+			msg += fmt.Sprintf(", but %s does, is named chrooted? Set --bind.chroot=%s", candidate, defaultChroot)
+		}
+		return msg
+	}
+	if origTarget != target && exists(origTarget) {
+		msg += fmt.Sprintf(", but %s outside of the chroot %s does, is --bind.chroot right?", origTarget, chroot)
+	} else if !exists(chroot) {
+		msg += fmt.Sprintf(", the chroot %s does not exist either", chroot)
+	}
+	return msg
+}
+
+// validatePaths explains mismatches between the paths the exporter uses and
+// the ones named is configured with.
+func validatePaths(conf *NamedConf, chroot, statsFile, pidFile string, explicit map[string]bool) []string {
+	var warnings []string
+	if conf != nil && explicit["bind.stats-file"] && conf.StatsFile() != statsFile {
+		warnings = append(warnings, fmt.Sprintf(
+			"--bind.stats-file %s differs from statistics-file %s in named.conf, rndc stats will write to the latter",
+			statsFile, conf.StatsFile()))
+	}
+	if conf != nil && explicit["bind.pid-file"] && conf.PidFile != "" && conf.Path(conf.PidFile) != pidFile {
+		warnings = append(warnings, fmt.Sprintf(
+			"--bind.pid-file %s differs from pid-file %s in named.conf",
+			pidFile, conf.Path(conf.PidFile)))
+	}
+	if msg := explainPath("Directory of the statistics file", unchrootPath(chroot, statsFile), statsFile, chroot, true); msg != "" {
+		warnings = append(warnings, msg)
+	}
+	if pidFile != "" {
+		if msg := explainPath("Pid file", unchrootPath(chroot, pidFile), pidFile, chroot, false); msg != "" {
+			warnings = append(warnings, msg)
+		}
+	}
+	return warnings
+}
+
+// unchrootPath is the inverse of chrootPath.
+func unchrootPath(chroot, p string) string {
+	if chroot == "" || chroot == "/" {
+		return p
+	}
+	chroot = filepath.Clean(chroot)
+	if rel := strings.TrimPrefix(p, chroot); rel != p && strings.HasPrefix(rel, string(filepath.Separator)) {
+		return rel
+	}
+	return p
+}
+
+func exists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
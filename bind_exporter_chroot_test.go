@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_ChrootPath(t *testing.T) {
+
+	for _, c := range []struct{ chroot, path, want string }{
+		{"", "/var/named/data/named_stats.txt", "/var/named/data/named_stats.txt"},
+		{"/var/named/chroot", "/var/named/data/named_stats.txt", "/var/named/chroot/var/named/data/named_stats.txt"},
+		{"/var/named/chroot/", "/run/named/named.pid", "/var/named/chroot/run/named/named.pid"},
+		{"/var/named/chroot", "/var/named/chroot/etc/named.conf", "/var/named/chroot/etc/named.conf"},
+		{"/var/named/chroot", "named.stats", "named.stats"},
+		{"/var/named/chroot", "", ""},
+	} {
+		if got := chrootPath(c.chroot, c.path); got != c.want {
+			t.Errorf("chrootPath(%q, %q) = %q, want %q", c.chroot, c.path, got, c.want)
+		}
+	}
+	if got := unchrootPath("/var/named/chroot", "/var/named/chroot/run/named/named.pid"); got != "/run/named/named.pid" {
+		t.Errorf("unchrootPath = %q", got)
+	}
+}
+
+func Test_ParserNamedConfChroot(t *testing.T) {
+
+	chroot := t.TempDir()
+	for path, content := range map[string]string{
+		"etc/named.conf":  "options { directory \"/var/named\"; };\ninclude \"/etc/named.zones\";\n",
+		"etc/named.zones": "zone \"example.com\" { type secondary; file \"slaves/example.com\"; };\n",
+	} {
+		if err := os.MkdirAll(filepath.Join(chroot, filepath.Dir(path)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(chroot, path), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conf, err := ParserNamedConf(chrootPath(chroot, "/etc/named.conf"), chroot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Zones) != 1 || conf.Zones[0].Type != "secondary" {
+		t.Errorf("zones = %+v", conf.Zones)
+	}
+	if want := filepath.Join(chroot, "/var/named/named.stats"); conf.StatsFile() != want {
+		t.Errorf("stats file = %s, want %s", conf.StatsFile(), want)
+	}
+	if want := filepath.Join(chroot, "/var/named/slaves/example.com"); conf.Path(conf.Zones[0].File) != want {
+		t.Errorf("zone file = %s, want %s", conf.Path(conf.Zones[0].File), want)
+	}
+}
+
+func Test_ValidatePaths(t *testing.T) {
+
+	dir := t.TempDir()
+	chroot := filepath.Join(dir, "chroot")
+	if err := os.MkdirAll(filepath.Join(dir, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	conf := &NamedConf{Chroot: chroot, StatisticsFile: filepath.Join(dir, "data/named.stats")}
+	statsFile := chrootPath(chroot, filepath.Join(dir, "data/other.stats"))
+	warnings := validatePaths(conf, chroot, statsFile, "", map[string]bool{"bind.stats-file": true})
+	if len(warnings) != 2 {
+		t.Fatalf("warnings = %q", warnings)
+	}
+	if !strings.Contains(warnings[0], "differs from statistics-file") {
+		t.Errorf("unexpected warning %q", warnings[0])
+	}
+	if !strings.Contains(warnings[1], "outside of the chroot") {
+		t.Errorf("unexpected warning %q", warnings[1])
+	}
+
+	if err := os.MkdirAll(filepath.Dir(statsFile), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if warnings := validatePaths(nil, chroot, statsFile, "", nil); len(warnings) != 0 {
+		t.Errorf("warnings = %q", warnings)
+	}
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// confStmt is one statement of named.conf: its words and, if present, the
+// statements of its last block. Clauses like allow { ... } keys { ... } have
+// a block each, kept by the index of the word before it.
+type confStmt struct {
+	args    []string
+	block   []*confStmt
+	clauses map[int][]*confStmt
+	// keyFile is the file of a key statement that is alone in its file,
+	// like rndc.key, so rndc -k can read it.
+	keyFile string
+}
+
+// arg returns the unquoted n-th word of the statement.
+func (s *confStmt) arg(n int) string {
+	if n >= len(s.args) {
+		return ""
+	}
+	return strings.Trim(s.args[n], `"`)
+}
+
+// clause returns the block following the word, as in keys { ... }.
+func (s *confStmt) clause(word string) []*confStmt {
+	for i := range s.args {
+		if s.arg(i) == word {
+			return s.clauses[i]
+		}
+	}
+	return nil
+}
+
+// NamedControl is an inet channel of the controls statement.
+type NamedControl struct {
+	Address string
+	Port    string
+	Keys    []string
+}
+
+// NamedKey is a key statement, as used by rndc. File is set when the key is
+// alone in an included file.
+type NamedKey struct {
+	Algorithm string
+	Secret    string
+	File      string
+}
+
+// NamedZone is a zone statement. View is "_default" for zones outside of
+// views.
+type NamedZone struct {
+	Name         string
+	View         string
+	Type         string
+	File         string
+	DNSSECPolicy string
+}
+
+// NamedConf holds what the exporter needs to know from named.conf. Paths are
+// as written in the configuration, use Path to resolve them.
+type NamedConf struct {
+	Chroot            string
+	Directory         string
+	StatisticsFile    string
+	PidFile           string
+	MemStatisticsFile string
+	RecursingFile     string
+	KeyDirectory      string
+	Controls          []NamedControl
+	Keys              map[string]NamedKey
+	Zones             []NamedZone
+}
+
+// Path resolves p relative to the directory option, like named does, and
+// maps it into the chroot.
+func (c *NamedConf) Path(p string) string {
+	if p != "" && !filepath.IsAbs(p) && c.Directory != "" {
+		p = filepath.Join(c.Directory, p)
+	}
+	return chrootPath(c.Chroot, p)
+}
+
+// StatsFile returns the resolved statistics-file, named.stats in the
+// directory unless configured.
+func (c *NamedConf) StatsFile() string {
+	if c.StatisticsFile == "" {
+		return c.Path("named.stats")
+	}
+	return c.Path(c.StatisticsFile)
+}
+
+// MemStatsFile returns the resolved memstatistics-file, named.memstats in the
+// directory unless configured.
+func (c *NamedConf) MemStatsFile() string {
+	if c.MemStatisticsFile == "" {
+		return c.Path("named.memstats")
+	}
+	return c.Path(c.MemStatisticsFile)
+}
+
+// KeyDirectoryPath returns the resolved key-directory, the directory unless
+// configured.
+func (c *NamedConf) KeyDirectoryPath() string {
+	if c.KeyDirectory == "" {
+		return c.Path(".")
+	}
+	return c.Path(c.KeyDirectory)
+}
+
+// RecursingFilePath returns the resolved recursing-file, named.recursing in
+// the directory unless configured.
+func (c *NamedConf) RecursingFilePath() string {
+	if c.RecursingFile == "" {
+		return c.Path("named.recursing")
+	}
+	return c.Path(c.RecursingFile)
+}
+
+// RndcControl points opts at the first inet channel of the controls
+// statement, so rndc uses the address, port and key named listens with. A key
+// alone in its file is passed as that file, an inline key is written to a
+// private key file in dir, or the default temporary directory if dir is
+// empty. The returned function removes that file.
+func (c *NamedConf) RndcControl(opts *RndcOpts, dir string) (func(), error) {
+	remove := func() {}
+	if len(c.Controls) == 0 {
+		return remove, nil
+	}
+	control := c.Controls[0]
+	switch control.Address {
+	case "*", "0.0.0.0":
+		opts.Server = "127.0.0.1"
+	case "::":
+		opts.Server = "::1"
+	default:
+		opts.Server = control.Address
+	}
+	opts.Port = control.Port
+	if len(control.Keys) == 0 {
+		return remove, nil
+	}
+	name := control.Keys[0]
+	key, ok := c.Keys[name]
+	if !ok || key.Secret == "" {
+		return remove, fmt.Errorf("Key %s of the controls statement is not in named.conf, using the default key of rndc", name)
+	}
+	if key.File != "" {
+		opts.KeyFile = key.File
+		return remove, nil
+	}
+	f, err := ioutil.TempFile(dir, "bind_stats_exporter.*.key")
+	if err != nil {
+		return remove, err
+	}
+	defer f.Close()
+	remove = func() { os.Remove(f.Name()) }
+	if _, err := fmt.Fprintf(f, "key %q {\n\talgorithm %s;\n\tsecret %q;\n};\n", name, key.Algorithm, key.Secret); err != nil {
+		remove()
+		return func() {}, err
+	}
+	opts.KeyFile = f.Name()
+	return remove, nil
+}
+
+// ParserNamedConf reads named.conf and the files it includes. Absolute
+// includes are mapped into chroot, relative ones are resolved against the
+// directory of the including file.
+func ParserNamedConf(path, chroot string) (*NamedConf, error) {
+	stmts, err := readConfStmts(path, chroot, 0)
+	if err != nil {
+		return nil, err
+	}
+	conf := &NamedConf{Chroot: chroot, Keys: map[string]NamedKey{}}
+	for _, stmt := range stmts {
+		switch stmt.arg(0) {
+		case "options":
+			for _, opt := range stmt.block {
+				switch opt.arg(0) {
+				case "directory":
+					conf.Directory = opt.arg(1)
+				case "statistics-file":
+					conf.StatisticsFile = opt.arg(1)
+				case "pid-file":
+					conf.PidFile = opt.arg(1)
+				case "memstatistics-file":
+					conf.MemStatisticsFile = opt.arg(1)
+				case "recursing-file":
+					conf.RecursingFile = opt.arg(1)
+				case "key-directory":
+					conf.KeyDirectory = opt.arg(1)
+				}
+			}
+		case "controls":
+			for _, ctl := range stmt.block {
+				if ctl.arg(0) != "inet" {
+					continue
+				}
+				control := NamedControl{Address: ctl.arg(1), Port: "953"}
+				for i := 2; i+1 < len(ctl.args); i++ {
+					if ctl.arg(i) == "port" {
+						control.Port = ctl.arg(i + 1)
+					}
+				}
+				for _, key := range ctl.clause("keys") {
+					control.Keys = append(control.Keys, key.arg(0))
+				}
+				conf.Controls = append(conf.Controls, control)
+			}
+		case "key":
+			key := parseNamedKey(stmt)
+			key.File = stmt.keyFile
+			conf.Keys[stmt.arg(1)] = key
+		case "view":
+			for _, vs := range stmt.block {
+				switch vs.arg(0) {
+				case "zone":
+					conf.Zones = append(conf.Zones, parseNamedZone(vs, stmt.arg(1)))
+				case "key":
+					conf.Keys[vs.arg(1)] = parseNamedKey(vs)
+				}
+			}
+		case "zone":
+			conf.Zones = append(conf.Zones, parseNamedZone(stmt, "_default"))
+		}
+	}
+	return conf, nil
+}
+
+func parseNamedKey(stmt *confStmt) NamedKey {
+	var key NamedKey
+	for _, ks := range stmt.block {
+		switch ks.arg(0) {
+		case "algorithm":
+			key.Algorithm = ks.arg(1)
+		case "secret":
+			key.Secret = ks.arg(1)
+		}
+	}
+	return key
+}
+
+func parseNamedZone(stmt *confStmt, view string) NamedZone {
+	zone := NamedZone{Name: strings.TrimSuffix(stmt.arg(1), "."), View: view}
+	if zone.Name == "" {
+		zone.Name = "."
+	}
+	for _, zs := range stmt.block {
+		switch zs.arg(0) {
+		case "type":
+			zone.Type = zs.arg(1)
+		case "file":
+			zone.File = zs.arg(1)
+		case "dnssec-policy":
+			zone.DNSSECPolicy = zs.arg(1)
+		}
+	}
+	return zone
+}
+
+// readConfStmts parses a configuration file, replacing include statements
+// with the statements of the included file.
+func readConfStmts(path, chroot string, depth int) ([]*confStmt, error) {
+	if depth > 16 {
+		return nil, fmt.Errorf("Too many nested includes at %s", path)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := tokenizeNamedConf(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("Can't parse %s: %s", path, err)
+	}
+	stmts, rest, err := parseConfBlock(tokens, false)
+	if err != nil {
+		return nil, fmt.Errorf("Can't parse %s: %s", path, err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("Can't parse %s: unexpected %q", path, rest[0])
+	}
+	if len(stmts) == 1 && stmts[0].arg(0) == "key" {
+		stmts[0].keyFile = path
+	}
+	return expandIncludes(stmts, filepath.Dir(path), chroot, depth)
+}
+
+func expandIncludes(stmts []*confStmt, dir, chroot string, depth int) ([]*confStmt, error) {
+	var expanded []*confStmt
+	for _, stmt := range stmts {
+		if stmt.arg(0) == "include" {
+			include := stmt.arg(1)
+			if filepath.IsAbs(include) {
+				include = chrootPath(chroot, include)
+			} else {
+				include = filepath.Join(dir, include)
+			}
+			included, err := readConfStmts(include, chroot, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			expanded = append(expanded, included...)
+			continue
+		}
+		if stmt.block != nil {
+			block, err := expandIncludes(stmt.block, dir, chroot, depth)
+			if err != nil {
+				return nil, err
+			}
+			stmt.block = block
+		}
+		expanded = append(expanded, stmt)
+	}
+	return expanded, nil
+}
+
+// parseConfBlock reads statements up to the closing brace of the block, or
+// the end of the tokens at the top level.
+func parseConfBlock(tokens []string, nested bool) ([]*confStmt, []string, error) {
+	stmts := []*confStmt{}
+	stmt := &confStmt{}
+	for len(tokens) > 0 {
+		token := tokens[0]
+		tokens = tokens[1:]
+		switch token {
+		case ";":
+			if len(stmt.args) > 0 || stmt.block != nil {
+				stmts = append(stmts, stmt)
+			}
+			stmt = &confStmt{}
+		case "{":
+			block, rest, err := parseConfBlock(tokens, true)
+			if err != nil {
+				return nil, nil, err
+			}
+			stmt.block, tokens = block, rest
+			if len(stmt.args) > 0 {
+				if stmt.clauses == nil {
+					stmt.clauses = map[int][]*confStmt{}
+				}
+				stmt.clauses[len(stmt.args)-1] = block
+			}
+		case "}":
+			if !nested {
+				return nil, nil, fmt.Errorf("unexpected }")
+			}
+			if len(stmt.args) > 0 {
+				return nil, nil, fmt.Errorf("missing ; after %q", strings.Join(stmt.args, " "))
+			}
+			return stmts, tokens, nil
+		default:
+			stmt.args = append(stmt.args, token)
+		}
+	}
+	if nested {
+		return nil, nil, fmt.Errorf("missing }")
+	}
+	if len(stmt.args) > 0 {
+		return nil, nil, fmt.Errorf("missing ; after %q", strings.Join(stmt.args, " "))
+	}
+	return stmts, nil, nil
+}
+
+// tokenizeNamedConf splits named.conf into words, quoted strings and the
+// characters { } ;, dropping C, C++ and shell style comments.
+func tokenizeNamedConf(content string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(content); {
+		ch := content[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n':
+			i++
+		case ch == '#' || strings.HasPrefix(content[i:], "//"):
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(content[i:], "/*"):
+			end := strings.Index(content[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+			i += end + 4
+		case ch == '"':
+			end := strings.IndexByte(content[i+1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string")
+			}
+			tokens = append(tokens, content[i:i+end+2])
+			i += end + 2
+		case ch == '{' || ch == '}' || ch == ';':
+			tokens = append(tokens, string(ch))
+			i++
+		default:
+			start := i
+			for i < len(content) && !strings.ContainsRune(" \t\r\n{};\"#", rune(content[i])) &&
+				!strings.HasPrefix(content[i:], "//") && !strings.HasPrefix(content[i:], "/*") {
+				i++
+			}
+			tokens = append(tokens, content[start:i])
+		}
+	}
+	return tokens, nil
+}
+
+// loadNamedConf parses named.conf for the defaults of the exporter. A missing
+// file is only reported when it was asked for explicitly.
+func loadNamedConf(path, chroot string, explicit bool) *NamedConf {
+	conf, err := ParserNamedConf(path, chroot)
+	if os.IsNotExist(err) && !explicit {
+		log.Infof("No %s, not reading defaults from it", path)
+		return nil
+	}
+	if err != nil {
+		log.Errorf("Can't read %s: %s", path, err)
+		return nil
+	}
+	return conf
+}
+
+type configCollector struct {
+	path     string
+	chroot   string
+	zoneInfo *prometheus.Desc
+}
+
+// NewConfigCollector exports the zones declared in named.conf, re-read on
+// every scrape so the inventory follows configuration reloads.
+func NewConfigCollector(path, chroot string) prometheus.Collector {
+	return &configCollector{
+		path:   path,
+		chroot: chroot,
+		zoneInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "config", "zone_info"),
+			"Zones declared in named.conf.",
+			[]string{"zone", "view", "type"}, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *configCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.zoneInfo
+}
+
+// Collect implements prometheus.Collector.
+func (c *configCollector) Collect(ch chan<- prometheus.Metric) {
+	conf, err := ParserNamedConf(c.path, c.chroot)
+	if err != nil {
+		log.Errorf("Can't read %s: %s", c.path, err)
+		return
+	}
+	seen := map[NamedZone]bool{}
+	for _, zone := range conf.Zones {
+		key := NamedZone{Name: zone.Name, View: zone.View, Type: zone.Type}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		ch <- prometheus.MustNewConstMetric(
+			c.zoneInfo, prometheus.GaugeValue, 1, zone.Name, zone.View, zone.Type,
+		)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const namedConf = `
+// options of the server
+options {
+	directory "/var/named";   # relative paths start here
+	statistics-file "data/named_stats.txt";
+	pid-file "/run/named/named.pid";
+	memstatistics-file "data/named_mem_stats.txt";
+	/* keys are kept
+	   next to the zones */
+	key-directory "keys";
+};
+
+include "rndc.key";
+
+controls {
+	inet 127.0.0.1 port 9953 allow { localhost; } keys { "rndc-key"; } read-only yes;
+};
+
+view "internal" {
+	match-clients { 10.0.0.0/8; !192.168.0.0/16; };
+	zone "example.com" IN {
+		type primary;
+		file "internal/example.com.zone";
+		dnssec-policy default;
+	};
+};
+
+zone "." {
+	type hint;
+	file "named.ca";
+};
+`
+
+const rndcKey = `key "rndc-key" {
+	algorithm hmac-sha256;
+	secret "c2VjcmV0";
+};
+`
+
+func writeNamedConf(t *testing.T) string {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "rndc.key"), []byte(rndcKey), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "named.conf")
+	if err := ioutil.WriteFile(path, []byte(namedConf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func Test_ParserNamedConf(t *testing.T) {
+
+	conf, err := ParserNamedConf(writeNamedConf(t), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.StatsFile() != "/var/named/data/named_stats.txt" || conf.PidFile != "/run/named/named.pid" ||
+		conf.Path(conf.KeyDirectory) != "/var/named/keys" || conf.MemStatisticsFile != "data/named_mem_stats.txt" {
+		t.Errorf("unexpected options %+v", conf)
+	}
+	wantControls := []NamedControl{{Address: "127.0.0.1", Port: "9953", Keys: []string{"rndc-key"}}}
+	if !reflect.DeepEqual(conf.Controls, wantControls) {
+		t.Errorf("controls = %+v", conf.Controls)
+	}
+	if key := conf.Keys["rndc-key"]; key.Algorithm != "hmac-sha256" || key.Secret != "c2VjcmV0" {
+		t.Errorf("key = %+v", key)
+	}
+	wantZones := []NamedZone{
+		{Name: "example.com", View: "internal", Type: "primary", File: "internal/example.com.zone", DNSSECPolicy: "default"},
+		{Name: ".", View: "_default", Type: "hint", File: "named.ca"},
+	}
+	if !reflect.DeepEqual(conf.Zones, wantZones) {
+		t.Errorf("zones = %+v", conf.Zones)
+	}
+}
+
+func Test_RndcControl(t *testing.T) {
+
+	path := writeNamedConf(t)
+	conf, err := ParserNamedConf(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := RndcOpts{Path: "/usr/sbin/rndc"}
+	remove, err := conf.RndcControl(&opts, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	remove()
+	keyFile := filepath.Join(filepath.Dir(path), "rndc.key")
+	if opts.Server != "127.0.0.1" || opts.Port != "9953" || opts.KeyFile != keyFile {
+		t.Fatalf("opts = %+v, want the included key file %s", opts, keyFile)
+	}
+	if _, err := os.Stat(keyFile); err != nil {
+		t.Errorf("included key file removed: %s", err)
+	}
+
+	// an inline key is written to a temporary file
+	key := conf.Keys["rndc-key"]
+	key.File = ""
+	conf.Keys["rndc-key"] = key
+	dir := t.TempDir()
+	opts = RndcOpts{}
+	remove, err = conf.RndcControl(&opts, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(opts.KeyFile) != dir {
+		t.Fatalf("key file = %s, want one in %s", opts.KeyFile, dir)
+	}
+	content, err := ioutil.ReadFile(opts.KeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != rndcKey {
+		t.Errorf("key file = %q, want %q", content, rndcKey)
+	}
+	remove()
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("%d files left in %s", len(files), dir)
+	}
+
+	conf.Controls[0].Address = "*"
+	conf.Keys = map[string]NamedKey{}
+	opts = RndcOpts{}
+	if _, err := conf.RndcControl(&opts, t.TempDir()); err == nil {
+		t.Error("expected an error for a missing key")
+	}
+	if opts.Server != "127.0.0.1" || opts.KeyFile != "" {
+		t.Errorf("opts = %+v", opts)
+	}
+}
+
+func Test_ConfClauses(t *testing.T) {
+
+	tokens, err := tokenizeNamedConf(`inet * allow { 10.0.0.1; localhost; } keys { "rndc-key"; } read-only yes;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts, _, err := parseConfBlock(tokens, false)
+	if err != nil || len(stmts) != 1 {
+		t.Fatalf("got %v, %v", stmts, err)
+	}
+	var allow []string
+	for _, acl := range stmts[0].clause("allow") {
+		allow = append(allow, acl.arg(0))
+	}
+	if !reflect.DeepEqual(allow, []string{"10.0.0.1", "localhost"}) {
+		t.Errorf("allow = %q", allow)
+	}
+	if keys := stmts[0].clause("keys"); len(keys) != 1 || keys[0].arg(0) != "rndc-key" {
+		t.Errorf("keys = %v", keys)
+	}
+	if stmts[0].clause("read-only") != nil {
+		t.Error("read-only has no block")
+	}
+}
+
+func Test_ParserNamedConfErrors(t *testing.T) {
+
+	for _, content := range []string{`options { directory "/var/named" };`, `options {`, `zone "x" { type hint; };}`, `/* open`} {
+		path := filepath.Join(t.TempDir(), "named.conf")
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ParserNamedConf(path, ""); err == nil {
+			t.Errorf("expected an error for %q", content)
+		}
+	}
+}
+
+func Test_ConfigCollector(t *testing.T) {
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewConfigCollector(writeNamedConf(t), ""))
+	want := `# HELP bind_config_zone_info Zones declared in named.conf.
+# TYPE bind_config_zone_info gauge
+bind_config_zone_info{type="hint",view="_default",zone="."} 1
+bind_config_zone_info{type="primary",view="internal",zone="example.com"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
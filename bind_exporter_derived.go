@@ -0,0 +1,166 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// counterRef names a counter of a statistics section.
+type counterRef struct {
+	section string
+	key     string
+}
+
+// derivedRatio is a gauge computed from the increase of two sets of counters
+// between two consecutive dumps.
+type derivedRatio struct {
+	desc        *prometheus.Desc
+	perView     bool
+	numerator   []counterRef
+	denominator []counterRef
+}
+
+var derivedRatios = []derivedRatio{
+	{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, DERIVED, "cache_hit_ratio"),
+			"Share of cache lookups from queries that were hits since the previous dump.",
+			[]string{"view"}, nil,
+		),
+		perView:   true,
+		numerator: []counterRef{{"Cache Statistics", "cache hits (from query)"}},
+		denominator: []counterRef{
+			{"Cache Statistics", "cache hits (from query)"},
+			{"Cache Statistics", "cache misses (from query)"},
+		},
+	},
+	{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, DERIVED, "servfail_ratio"),
+			"Share of responses that were SERVFAIL since the previous dump.",
+			nil, nil,
+		),
+		numerator:   []counterRef{{"Name Server Statistics", "queries resulted in SERVFAIL"}},
+		denominator: []counterRef{{"Name Server Statistics", "responses sent"}},
+	},
+	{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, DERIVED, "recursion_ratio"),
+			"Share of queries that caused recursion since the previous dump.",
+			nil, nil,
+		),
+		numerator:   []counterRef{{"Name Server Statistics", "queries caused recursion"}},
+		denominator: []counterRef{{"Incoming Requests", "QUERY"}},
+	},
+	{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, DERIVED, "resolver_timeout_ratio"),
+			"Share of resolver queries that timed out since the previous dump.",
+			[]string{"view"}, nil,
+		),
+		perView:   true,
+		numerator: []counterRef{{"Resolver Statistics", "query timeouts"}},
+		denominator: []counterRef{
+			{"Resolver Statistics", "IPv4 queries sent"},
+			{"Resolver Statistics", "IPv6 queries sent"},
+		},
+	},
+	{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, DERIVED, "truncated_ratio"),
+			"Share of responses that were truncated since the previous dump.",
+			nil, nil,
+		),
+		numerator:   []counterRef{{"Name Server Statistics", "truncated responses sent"}},
+		denominator: []counterRef{{"Name Server Statistics", "responses sent"}},
+	},
+}
+
+// derivedValue is one sample of a derived ratio.
+type derivedValue struct {
+	ratio *derivedRatio
+	view  string
+	value float64
+}
+
+// deriveRatios computes the derived ratios between two dumps. Ratios without
+// traffic in between, or whose counters went backwards because BIND was
+// restarted, are left out.
+func deriveRatios(prev, cur *StatusInfo) []derivedValue {
+	var values []derivedValue
+	for i := range derivedRatios {
+		ratio := &derivedRatios[i]
+		views := []string{""}
+		if ratio.perView {
+			views = counterViews(cur, ratio.denominator)
+		}
+		for _, view := range views {
+			num := counterSum(cur, ratio.numerator, view) - counterSum(prev, ratio.numerator, view)
+			den := counterSum(cur, ratio.denominator, view) - counterSum(prev, ratio.denominator, view)
+			if den <= 0 || num < 0 {
+				continue
+			}
+			values = append(values, derivedValue{ratio: ratio, view: view, value: num / den})
+		}
+	}
+	return values
+}
+
+// counterSum adds up the referenced counters, across all views unless view
+// is set.
+func counterSum(statsInfo *StatusInfo, refs []counterRef, view string) float64 {
+	var sum float64
+	for _, ref := range refs {
+		for _, md := range statsInfo.ModuleMap[ref.section] {
+			if view != "" && cacheViewName(md.View) != view {
+				continue
+			}
+			sum += md.Info[ref.key]
+		}
+	}
+	return sum
+}
+
+// counterViews lists the views that have any of the referenced counters.
+func counterViews(statsInfo *StatusInfo, refs []counterRef) []string {
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		for _, md := range statsInfo.ModuleMap[ref.section] {
+			if _, ok := md.Info[ref.key]; ok && md.View != "" {
+				seen[cacheViewName(md.View)] = true
+			}
+		}
+	}
+	views := make([]string, 0, len(seen))
+	for view := range seen {
+		views = append(views, view)
+	}
+	sort.Strings(views)
+	return views
+}
+
+// collectDerived exports the ratios between the previous dump and statsInfo,
+// and keeps statsInfo for the next collection. A dump shared by coalesced
+// scrapes is compared with the same previous dump again.
+func (c *statsCollector) collectDerived(ch chan<- prometheus.Metric, statsInfo *StatusInfo) {
+	c.mu.Lock()
+	if statsInfo != c.prev {
+		c.base, c.prev = c.prev, statsInfo
+	}
+	prev := c.base
+	c.mu.Unlock()
+	if prev == nil {
+		return
+	}
+	emit := c.emitter(ch, statsInfo)
+	for _, dv := range deriveRatios(prev, statsInfo) {
+		var labels []string
+		if dv.ratio.perView {
+			labels = append(labels, dv.view)
+		}
+		emit(prometheus.MustNewConstMetric(
+			dv.ratio.desc, prometheus.GaugeValue, dv.value, labels...,
+		))
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func bumpCounter(statsInfo *StatusInfo, section, view, key string, delta float64) {
+	for _, md := range statsInfo.ModuleMap[section] {
+		if cacheViewName(md.View) == view {
+			md.Info[key] += delta
+		}
+	}
+}
+
+func Test_DeriveRatios(t *testing.T) {
+
+	prev, cur := ParserStats(str), ParserStats(str)
+	bumpCounter(cur, "Name Server Statistics", "", "responses sent", 1000)
+	bumpCounter(cur, "Name Server Statistics", "", "queries resulted in SERVFAIL", 10)
+	bumpCounter(cur, "Name Server Statistics", "", "truncated responses sent", 50)
+	bumpCounter(cur, "Name Server Statistics", "", "queries caused recursion", 500)
+	bumpCounter(cur, "Incoming Requests", "", "QUERY", 2000)
+	bumpCounter(cur, "Resolver Statistics", "view_bj_ali", "IPv4 queries sent", 100)
+	bumpCounter(cur, "Resolver Statistics", "view_bj_ali", "query timeouts", 5)
+
+	got := map[string]float64{}
+	for _, dv := range deriveRatios(prev, cur) {
+		got[dv.ratio.desc.String()+dv.view] = dv.value
+	}
+	want := map[string]float64{
+		derivedRatios[1].desc.String():                 0.01,
+		derivedRatios[2].desc.String():                 0.25,
+		derivedRatios[3].desc.String() + "view_bj_ali": 0.05,
+		derivedRatios[4].desc.String():                 0.05,
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d ratios, want %d: %v", len(got), len(want), got)
+	}
+	for key, value := range want {
+		if math.Abs(got[key]-value) > 1e-9 {
+			t.Errorf("%s = %v, want %v", key, got[key], value)
+		}
+	}
+}
+
+func Test_DeriveRatiosPerView(t *testing.T) {
+
+	prev, cur := ParserStats(str2), ParserStats(str2)
+	bumpCounter(cur, "Cache Statistics", "view_bj_ali", "cache hits (from query)", 30)
+	bumpCounter(cur, "Cache Statistics", "view_bj_ali", "cache misses (from query)", 10)
+	values := deriveRatios(prev, cur)
+	if len(values) != 1 || values[0].view != "view_bj_ali" || values[0].value != 0.75 {
+		t.Errorf("got %+v, want a 0.75 cache hit ratio for view_bj_ali", values)
+	}
+}
+
+func Test_DeriveRatiosAfterRestart(t *testing.T) {
+
+	if values := deriveRatios(ParserStats(str), ParserStats(str2)); len(values) != 0 {
+		t.Errorf("got %+v after counters went backwards", values)
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+var (
+	zoneJournalBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "zone", "journal_bytes"),
+		"Size of the journal of a dynamic zone, zone and view are empty for journals of unknown zones.",
+		zoneFileLabels, nil,
+	)
+	zoneFileBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "zone_file", "bytes"),
+		"Size of the zone file.",
+		zoneFileLabels, nil,
+	)
+	zoneFileModified = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "zone_file", "modified_timestamp_seconds"),
+		"Modification time of the zone file since unix epoch in seconds.",
+		zoneFileLabels, nil,
+	)
+	filesystemSize = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "filesystem", "size_bytes"),
+		"Size of the filesystem holding the directory.",
+		[]string{"path"}, nil,
+	)
+	filesystemAvail = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "filesystem", "avail_bytes"),
+		"Space of the filesystem holding the directory available to named, which doesn't run as root.",
+		[]string{"path"}, nil,
+	)
+	filesystemFiles = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "filesystem", "files_free"),
+		"Free inodes of the filesystem holding the directory.",
+		[]string{"path"}, nil,
+	)
+)
+
+// filesystemStats is the space of a filesystem, see statFilesystem.
+type filesystemStats struct {
+	size      float64
+	avail     float64
+	filesFree float64
+}
+
+// DiskOpts configures the disk usage collector.
+type DiskOpts struct {
+	// Dirs are walked for journals, their filesystems are reported too.
+	Dirs []string
+	// Zones map journals and zone files to zones.
+	Zones []NamedZone
+}
+
+type diskCollector struct {
+	opts DiskOpts
+}
+
+// NewDiskCollector exports the size of zone files and journals and the free
+// space of the filesystems named writes to.
+func NewDiskCollector(opts DiskOpts) prometheus.Collector {
+	return &diskCollector{opts: opts}
+}
+
+// Describe implements prometheus.Collector.
+func (c *diskCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- zoneJournalBytes
+	ch <- zoneFileBytes
+	ch <- zoneFileModified
+	ch <- filesystemSize
+	ch <- filesystemAvail
+	ch <- filesystemFiles
+}
+
+// Collect implements prometheus.Collector.
+func (c *diskCollector) Collect(ch chan<- prometheus.Metric) {
+	journals := map[string][]NamedZone{}
+	seen := map[NamedZone]bool{}
+	for _, zone := range c.opts.Zones {
+		zone = NamedZone{Name: zone.Name, View: zone.View, File: filepath.Clean(zone.File)}
+		if zone.File == "." || seen[zone] {
+			continue
+		}
+		seen[zone] = true
+		journals[zone.File+".jnl"] = append(journals[zone.File+".jnl"], zone)
+		fi, err := os.Stat(zone.File)
+		if err != nil {
+			log.Warnf("Can't stat zone file of %s: %s", zone.Name, err)
+			continue
+		}
+		labels := []string{zone.Name, zone.View, zone.File}
+		ch <- prometheus.MustNewConstMetric(zoneFileBytes, prometheus.GaugeValue, float64(fi.Size()), labels...)
+		ch <- prometheus.MustNewConstMetric(zoneFileModified, prometheus.GaugeValue, float64(fi.ModTime().Unix()), labels...)
+	}
+
+	done := map[string]bool{}
+	for _, dir := range c.opts.Dirs {
+		dir = filepath.Clean(dir)
+		if done[dir] {
+			continue
+		}
+		done[dir] = true
+		if stats, err := statFilesystem(dir); err != nil {
+			log.Errorf("Can't stat filesystem of %s: %s", dir, err)
+		} else {
+			ch <- prometheus.MustNewConstMetric(filesystemSize, prometheus.GaugeValue, stats.size, dir)
+			ch <- prometheus.MustNewConstMetric(filesystemAvail, prometheus.GaugeValue, stats.avail, dir)
+			ch <- prometheus.MustNewConstMetric(filesystemFiles, prometheus.GaugeValue, stats.filesFree, dir)
+		}
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				log.Warnf("Can't walk %s: %s", path, err)
+				if d != nil && d.IsDir() && path != dir {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() || !strings.HasSuffix(path, ".jnl") || !d.Type().IsRegular() {
+				return nil
+			}
+			if done[path] {
+				return nil
+			}
+			done[path] = true
+			fi, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			zones := journals[path]
+			if len(zones) == 0 {
+				zones = []NamedZone{{}}
+			}
+			for _, zone := range zones {
+				ch <- prometheus.MustNewConstMetric(
+					zoneJournalBytes, prometheus.GaugeValue, float64(fi.Size()), zone.Name, zone.View, path,
+				)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Errorf("Can't walk %s: %s", dir, err)
+		}
+	}
+	// journals of zones with files outside of the walked directories
+	for path, zones := range journals {
+		if done[path] {
+			continue
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		for _, zone := range zones {
+			ch <- prometheus.MustNewConstMetric(
+				zoneJournalBytes, prometheus.GaugeValue, float64(fi.Size()), zone.Name, zone.View, path,
+			)
+		}
+	}
+}
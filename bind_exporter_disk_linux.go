@@ -0,0 +1,15 @@
+package main
+
+import "syscall"
+
+func statFilesystem(path string) (filesystemStats, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return filesystemStats{}, err
+	}
+	return filesystemStats{
+		size:      float64(st.Blocks) * float64(st.Bsize),
+		avail:     float64(st.Bavail) * float64(st.Bsize),
+		filesFree: float64(st.Ffree),
+	}, nil
+}
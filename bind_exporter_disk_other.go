@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+func statFilesystem(path string) (filesystemStats, error) {
+	return filesystemStats{}, errors.New("filesystem statistics are only supported on Linux")
+}
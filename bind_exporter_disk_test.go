@@ -0,0 +1,60 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_DiskCollector(t *testing.T) {
+
+	dir := t.TempDir()
+	for path, size := range map[string]int{
+		"dynamic/example.com.db":     100,
+		"dynamic/example.com.db.jnl": 2048,
+		"managed-keys.bind.jnl":      512,
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(path)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, path), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zoneFile := filepath.Join(dir, "dynamic/example.com.db")
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewDiskCollector(DiskOpts{
+		Dirs:  []string{dir, dir + "/"},
+		Zones: []NamedZone{{Name: "example.com", View: "_default", File: zoneFile, Type: "primary"}},
+	}))
+	want := `# HELP bind_zone_file_bytes Size of the zone file.
+# TYPE bind_zone_file_bytes gauge
+bind_zone_file_bytes{file="` + zoneFile + `",view="_default",zone="example.com"} 100
+# HELP bind_zone_journal_bytes Size of the journal of a dynamic zone, zone and view are empty for journals of unknown zones.
+# TYPE bind_zone_journal_bytes gauge
+bind_zone_journal_bytes{file="` + zoneFile + `.jnl",view="_default",zone="example.com"} 2048
+bind_zone_journal_bytes{file="` + filepath.Join(dir, "managed-keys.bind.jnl") + `",view="",zone=""} 512
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want), "bind_zone_file_bytes", "bind_zone_journal_bytes"); err != nil {
+		t.Error(err)
+	}
+
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == "bind_filesystem_avail_bytes" {
+			if len(mf.GetMetric()) != 1 || mf.GetMetric()[0].GetGauge().GetValue() <= 0 {
+				t.Errorf("unexpected available space %v", mf.GetMetric())
+			}
+			return
+		}
+	}
+	t.Error("no available space exported")
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+var (
+	keyFileReg   = regexp.MustCompile(`^K(.+)\.\+(\d{3})\+(\d{5})\.key$`)
+	keyTimingReg = regexp.MustCompile(`^;?\s*([A-Za-z]+):\s+(\d{14})\b`)
+
+	dnssecKeyTiming = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "dnssec", "key_timing_seconds"),
+		"Timing metadata of DNSSEC keys in the key directory since unix epoch in seconds.",
+		[]string{"zone", "key_tag", "algorithm", "role", "event"}, nil,
+	)
+
+	// dnssecAlgorithms names the DNSSEC algorithm numbers in use.
+	dnssecAlgorithms = map[int]string{
+		5:  "RSASHA1",
+		7:  "NSEC3RSASHA1",
+		8:  "RSASHA256",
+		10: "RSASHA512",
+		13: "ECDSAP256SHA256",
+		14: "ECDSAP384SHA384",
+		15: "ED25519",
+		16: "ED448",
+	}
+
+	// keyTimingEvents maps the timing fields of .key and .private files, and
+	// of the .state files of dnssec-policy, to event names.
+	keyTimingEvents = map[string]string{
+		"Created":     "created",
+		"Publish":     "publish",
+		"Activate":    "activate",
+		"Revoke":      "revoke",
+		"Inactive":    "inactive",
+		"Delete":      "delete",
+		"SyncPublish": "sync_publish",
+		"SyncDelete":  "sync_delete",
+		"Generated":   "created",
+		"Published":   "publish",
+		"Active":      "activate",
+		"Retired":     "inactive",
+		"Removed":     "delete",
+		"Revoked":     "revoke",
+	}
+)
+
+// DNSSECKey is a key found in a key directory.
+type DNSSECKey struct {
+	Zone      string
+	Tag       int
+	Algorithm int
+	// Role is ksk, zsk or csk.
+	Role   string
+	Timing map[string]time.Time
+}
+
+// AlgorithmName returns the mnemonic of the key algorithm.
+func (k *DNSSECKey) AlgorithmName() string {
+	if name, ok := dnssecAlgorithms[k.Algorithm]; ok {
+		return name
+	}
+	return strconv.Itoa(k.Algorithm)
+}
+
+// ReadDNSSECKeys parses the K<zone>+<alg>+<tag> files of a key directory.
+// Timing in .private files wins over the comments of .key files, .state
+// files of dnssec-policy fill in what is missing.
+func ReadDNSSECKeys(dir string) ([]*DNSSECKey, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var keys []*DNSSECKey
+	for _, entry := range entries {
+		m := keyFileReg.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+		key := &DNSSECKey{Zone: strings.TrimSuffix(m[1], "."), Timing: map[string]time.Time{}}
+		if key.Zone == "" {
+			key.Zone = "."
+		}
+		key.Algorithm, _ = strconv.Atoi(m[2])
+		key.Tag, _ = strconv.Atoi(m[3])
+		base := filepath.Join(dir, strings.TrimSuffix(entry.Name(), ".key"))
+		for _, ext := range []string{".private", ".key", ".state"} {
+			if err := readKeyFile(base+ext, key); err != nil && !os.IsNotExist(err) {
+				log.Warnf("Can't read %s: %s", base+ext, err)
+			}
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Zone != keys[j].Zone {
+			return keys[i].Zone < keys[j].Zone
+		}
+		return keys[i].Tag < keys[j].Tag
+	})
+	return keys, nil
+}
+
+// readKeyFile adds the timing and role found in one file of a key to key,
+// keeping what earlier files set.
+func readKeyFile(path string, key *DNSSECKey) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	ksk, zsk := false, false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if m := keyTimingReg.FindStringSubmatch(line); m != nil {
+			event, ok := keyTimingEvents[m[1]]
+			if !ok {
+				continue
+			}
+			if _, set := key.Timing[event]; set {
+				continue
+			}
+			if t, err := time.Parse("20060102150405", m[2]); err == nil {
+				key.Timing[event] = t
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		switch {
+		case strings.HasSuffix(path, ".state") && len(fields) == 2 && fields[1] == "yes":
+			ksk = ksk || fields[0] == "KSK:"
+			zsk = zsk || fields[0] == "ZSK:"
+		case !strings.HasPrefix(line, ";"):
+			// example.com. 3600 IN DNSKEY 257 3 13 <key>
+			for i, field := range fields {
+				if field == "DNSKEY" && i+1 < len(fields) && key.Role == "" {
+					if flags, err := strconv.Atoi(fields[i+1]); err == nil && flags&1 == 1 {
+						key.Role = "ksk"
+					} else {
+						key.Role = "zsk"
+					}
+				}
+			}
+		}
+	}
+	if ksk && zsk {
+		key.Role = "csk"
+	}
+	return scanner.Err()
+}
+
+type dnssecKeysCollector struct {
+	dirs []string
+}
+
+// NewDNSSECKeysCollector exports the timing metadata of the keys in dirs.
+func NewDNSSECKeysCollector(dirs []string) prometheus.Collector {
+	return &dnssecKeysCollector{dirs: dirs}
+}
+
+// Describe implements prometheus.Collector.
+func (c *dnssecKeysCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dnssecKeyTiming
+}
+
+// Collect implements prometheus.Collector.
+func (c *dnssecKeysCollector) Collect(ch chan<- prometheus.Metric) {
+	type keyID struct {
+		zone string
+		tag  int
+		alg  int
+	}
+	seen := map[keyID]bool{}
+	for _, dir := range c.dirs {
+		keys, err := ReadDNSSECKeys(dir)
+		if err != nil {
+			log.Errorf("Can't read key directory: %s", err)
+			continue
+		}
+		for _, key := range keys {
+			id := keyID{key.Zone, key.Tag, key.Algorithm}
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			for event, t := range key.Timing {
+				ch <- prometheus.MustNewConstMetric(
+					dnssecKeyTiming, prometheus.GaugeValue, float64(t.Unix()),
+					key.Zone, strconv.Itoa(key.Tag), key.AlgorithmName(), key.Role, event,
+				)
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_ReadDNSSECKeys(t *testing.T) {
+
+	keys, err := ReadDNSSECKeys("testdata/keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 3 {
+		t.Fatalf("got %d keys, want 3", len(keys))
+	}
+	ksk := keys[0]
+	if ksk.Zone != "example.com" || ksk.Tag != 12345 || ksk.AlgorithmName() != "ECDSAP256SHA256" || ksk.Role != "ksk" {
+		t.Errorf("unexpected key %+v", ksk)
+	}
+	if want := time.Date(2021, 9, 24, 3, 35, 58, 0, time.UTC); !ksk.Timing["delete"].Equal(want) {
+		t.Errorf("delete = %s, want %s from the .private file", ksk.Timing["delete"], want)
+	}
+	if keys[1].Role != "zsk" || len(keys[1].Timing) != 3 {
+		t.Errorf("unexpected key %+v", keys[1])
+	}
+	if csk := keys[2]; csk.Role != "csk" || csk.AlgorithmName() != "RSASHA256" || !csk.Timing["activate"].Equal(time.Date(2024, 9, 5, 9, 12, 44, 0, time.UTC)) {
+		t.Errorf("unexpected key %+v", csk)
+	}
+}
+
+func Test_DNSSECKeysCollector(t *testing.T) {
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewDNSSECKeysCollector([]string{"testdata/keys", "testdata/keys", "testdata/missing"}))
+	want := `# HELP bind_dnssec_key_timing_seconds Timing metadata of DNSSEC keys in the key directory since unix epoch in seconds.
+# TYPE bind_dnssec_key_timing_seconds gauge
+bind_dnssec_key_timing_seconds{algorithm="ECDSAP256SHA256",event="activate",key_tag="12345",role="ksk",zone="example.com"} 1.598240158e+09
+bind_dnssec_key_timing_seconds{algorithm="ECDSAP256SHA256",event="activate",key_tag="54321",role="zsk",zone="example.com"} 1.598240159e+09
+bind_dnssec_key_timing_seconds{algorithm="ECDSAP256SHA256",event="created",key_tag="12345",role="ksk",zone="example.com"} 1.598240158e+09
+bind_dnssec_key_timing_seconds{algorithm="ECDSAP256SHA256",event="created",key_tag="54321",role="zsk",zone="example.com"} 1.598240159e+09
+bind_dnssec_key_timing_seconds{algorithm="ECDSAP256SHA256",event="delete",key_tag="12345",role="ksk",zone="example.com"} 1.632454558e+09
+bind_dnssec_key_timing_seconds{algorithm="ECDSAP256SHA256",event="inactive",key_tag="12345",role="ksk",zone="example.com"} 1.629776158e+09
+bind_dnssec_key_timing_seconds{algorithm="ECDSAP256SHA256",event="publish",key_tag="12345",role="ksk",zone="example.com"} 1.598240158e+09
+bind_dnssec_key_timing_seconds{algorithm="ECDSAP256SHA256",event="publish",key_tag="54321",role="zsk",zone="example.com"} 1.598240159e+09
+bind_dnssec_key_timing_seconds{algorithm="RSASHA256",event="activate",key_tag="1000",role="csk",zone="example.org"} 1.725527564e+09
+bind_dnssec_key_timing_seconds{algorithm="RSASHA256",event="created",key_tag="1000",role="csk",zone="example.org"} 1.725527564e+09
+bind_dnssec_key_timing_seconds{algorithm="RSASHA256",event="publish",key_tag="1000",role="csk",zone="example.org"} 1.725527564e+09
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+var (
+	dnssecStatusKeyReg   = regexp.MustCompile(`^key: (\d+) \(([^)]+)\), (\w+)`)
+	dnssecStatusStateReg = regexp.MustCompile(`^- ([a-z ]+):\s+(\w+)$`)
+	dnssecRolloverReg    = regexp.MustCompile(`^Next rollover scheduled on (.+)$`)
+
+	// dnssecKeyStates are the states of the key state machine of
+	// dnssec-policy, all exported so a state change doesn't leave stale series.
+	dnssecKeyStates = []string{"hidden", "rumoured", "omnipresent", "unretentive"}
+
+	dnssecKeyState = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "dnssec", "key_state"),
+		"State of the records of a dnssec-policy key, 1 for the current state.",
+		[]string{"zone", "view", "key_tag", "record", "state"}, nil,
+	)
+	dnssecKeyGoal = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "dnssec", "key_goal"),
+		"State a dnssec-policy key is moving to, 1 for the current goal.",
+		[]string{"zone", "view", "key_tag", "state"}, nil,
+	)
+	dnssecNextEvent = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "dnssec", "next_event_timestamp_seconds"),
+		"Time of the next scheduled rollover of a dnssec-policy key since unix epoch in seconds.",
+		[]string{"zone", "view", "key_tag"}, nil,
+	)
+	dnssecPolicy = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "dnssec", "policy_info"),
+		"dnssec-policy of the zone as reported by rndc dnssec -status.",
+		[]string{"zone", "view", "policy"}, nil,
+	)
+)
+
+// KASPKey is a key listed by rndc dnssec -status. States holds the state of
+// each record, Goal the state the key is moving to.
+type KASPKey struct {
+	Tag          int
+	Algorithm    string
+	Role         string
+	Goal         string
+	States       map[string]string
+	NextRollover time.Time
+}
+
+// KASPStatus is the parsed output of rndc dnssec -status.
+type KASPStatus struct {
+	Policy string
+	Keys   []*KASPKey
+}
+
+// ParserDNSSECStatus parses the output of rndc dnssec -status. Times are
+// printed by named in its local time zone, loc.
+func ParserDNSSECStatus(out string, loc *time.Location) *KASPStatus {
+	status := &KASPStatus{}
+	var key *KASPKey
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "dnssec-policy: ") {
+			status.Policy = strings.TrimPrefix(line, "dnssec-policy: ")
+		} else if m := dnssecStatusKeyReg.FindStringSubmatch(line); m != nil {
+			key = &KASPKey{Algorithm: m[2], Role: strings.ToLower(m[3]), States: map[string]string{}}
+			key.Tag, _ = strconv.Atoi(m[1])
+			status.Keys = append(status.Keys, key)
+		} else if key == nil {
+			continue
+		} else if m := dnssecStatusStateReg.FindStringSubmatch(line); m != nil && m[1] == "goal" {
+			key.Goal = m[2]
+		} else if m != nil {
+			// zone rrsig becomes zone_rrsig
+			key.States[strings.ReplaceAll(m[1], " ", "_")] = m[2]
+		} else if m := dnssecRolloverReg.FindStringSubmatch(line); m != nil {
+			if t, err := time.ParseInLocation(time.ANSIC, m[1], loc); err == nil {
+				key.NextRollover = t
+			}
+		}
+	}
+	return status
+}
+
+// DNSSECStatusOpts configures the rndc dnssec -status collector.
+type DNSSECStatusOpts struct {
+	Zones       []NamedZone
+	Concurrency int
+	CacheTTL    time.Duration
+}
+
+type dnssecStatusCollector struct {
+	zones   []NamedZone
+	command *zoneCommand
+	up      *prometheus.Desc
+}
+
+// NewDNSSECStatusCollector runs rndc dnssec -status for every zone and view,
+// with a concurrency limit and cache like the zonestatus collector. Each view
+// may sign a zone with its own policy and keys.
+func NewDNSSECStatusCollector(run rndcRunner, opts DNSSECStatusOpts) prometheus.Collector {
+	return &dnssecStatusCollector{
+		zones:   uniqueZones(opts.Zones),
+		command: newZoneCommand(run, opts.Concurrency, opts.CacheTTL, "dnssec", "-status"),
+		up:      newRndcUpDesc("dnssec"),
+	}
+}
+
+// policyZones returns the zones of named.conf signed with a dnssec-policy.
+func policyZones(conf *NamedConf) []NamedZone {
+	var zones []NamedZone
+	for _, zone := range conf.Zones {
+		if zone.DNSSECPolicy != "" && zone.DNSSECPolicy != "none" && zone.DNSSECPolicy != "insecure" {
+			zones = append(zones, zone)
+		}
+	}
+	return zones
+}
+
+// Describe implements prometheus.Collector.
+func (c *dnssecStatusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+	ch <- dnssecKeyState
+	ch <- dnssecKeyGoal
+	ch <- dnssecNextEvent
+	ch <- dnssecPolicy
+}
+
+// Collect implements prometheus.Collector.
+func (c *dnssecStatusCollector) Collect(ch chan<- prometheus.Metric) {
+	outputs := c.command.runAll(c.zones)
+	failed := 0
+	for i, zone := range c.zones {
+		if outputs[i].err != nil {
+			log.Errorf("Zone %s in view %s: %s", zone.Name, zone.View, outputs[i].err)
+			failed++
+			continue
+		}
+		status := ParserDNSSECStatus(outputs[i].out, time.Local)
+		if status.Policy != "" {
+			ch <- prometheus.MustNewConstMetric(dnssecPolicy, prometheus.GaugeValue, 1, zone.Name, zone.View, status.Policy)
+		}
+		for _, key := range status.Keys {
+			tag := strconv.Itoa(key.Tag)
+			if key.Goal != "" {
+				for _, state := range dnssecKeyStates {
+					ch <- prometheus.MustNewConstMetric(
+						dnssecKeyGoal, prometheus.GaugeValue, boolToFloat(state == key.Goal),
+						zone.Name, zone.View, tag, state,
+					)
+				}
+			}
+			for record, current := range key.States {
+				for _, state := range dnssecKeyStates {
+					ch <- prometheus.MustNewConstMetric(
+						dnssecKeyState, prometheus.GaugeValue, boolToFloat(state == current),
+						zone.Name, zone.View, tag, record, state,
+					)
+				}
+			}
+			if !key.NextRollover.IsZero() {
+				ch <- prometheus.MustNewConstMetric(
+					dnssecNextEvent, prometheus.GaugeValue, float64(key.NextRollover.Unix()), zone.Name, zone.View, tag,
+				)
+			}
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, zonesUp(len(c.zones), failed))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_ParserDNSSECStatus(t *testing.T) {
+
+	run := fixtureRunner(t, map[string]string{"dnssec -status example.com": "rndc.dnssec.status"})
+	out, err := run("dnssec", "-status", "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := ParserDNSSECStatus(out, time.UTC)
+	if status.Policy != "standard" || len(status.Keys) != 3 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	ksk := status.Keys[0]
+	if ksk.Tag != 1000 || ksk.Role != "ksk" || ksk.Algorithm != "ECDSAP256SHA256" || ksk.Goal != "omnipresent" ||
+		ksk.States["ds"] != "rumoured" || ksk.States["key_rrsig"] != "omnipresent" || len(ksk.States) != 3 ||
+		!ksk.NextRollover.IsZero() {
+		t.Errorf("unexpected key %+v", ksk)
+	}
+	if want := time.Date(2024, 10, 4, 9, 12, 44, 0, time.UTC); !status.Keys[1].NextRollover.Equal(want) {
+		t.Errorf("next rollover = %s, want %s", status.Keys[1].NextRollover, want)
+	}
+	if status.Keys[2].Goal != "hidden" || status.Keys[2].States["dnskey"] != "unretentive" {
+		t.Errorf("unexpected key %+v", status.Keys[2])
+	}
+}
+
+func Test_DNSSECStatusCollector(t *testing.T) {
+
+	run := fixtureRunner(t, map[string]string{
+		"dnssec -status example.com IN internal": "rndc.dnssec.status",
+		"dnssec -status example.com IN external": "rndc.dnssec.status.external",
+	})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewDNSSECStatusCollector(run, DNSSECStatusOpts{
+		Zones: policyZones(&NamedConf{Zones: []NamedZone{
+			{Name: "example.com", View: "internal", DNSSECPolicy: "standard"},
+			{Name: "example.com", View: "external", DNSSECPolicy: "standard"},
+			{Name: "example.net", View: "internal", DNSSECPolicy: "none"},
+		}}),
+		CacheTTL: time.Minute,
+	}))
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := map[string]float64{}
+	goals := map[string]float64{}
+	nextEvents := 0
+	for _, mf := range mfs {
+		if mf.GetName() == "bind_dnssec_next_event_timestamp_seconds" {
+			nextEvents = len(mf.GetMetric())
+		}
+		if mf.GetName() != "bind_dnssec_key_state" && mf.GetName() != "bind_dnssec_key_goal" {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if mf.GetName() == "bind_dnssec_key_goal" {
+				goals[labels["view"]+"/"+labels["key_tag"]+"/"+labels["state"]] = m.GetGauge().GetValue()
+			} else {
+				states[labels["view"]+"/"+labels["key_tag"]+"/"+labels["record"]+"/"+labels["state"]] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	// internal: 3 keys with 3, 2 and 2 records, external: 1 key with 4
+	// records, in 4 states each
+	if len(states) != 44 || states["internal/1000/ds/rumoured"] != 1 || states["internal/1000/ds/hidden"] != 0 ||
+		states["internal/2001/dnskey/unretentive"] != 1 || states["internal/1000/goal/omnipresent"] != 0 ||
+		states["external/3000/ds/hidden"] != 1 {
+		t.Errorf("unexpected key states %v", states)
+	}
+	if len(goals) != 16 || goals["internal/1000/omnipresent"] != 1 || goals["internal/2001/hidden"] != 1 ||
+		goals["internal/2001/omnipresent"] != 0 || goals["external/3000/omnipresent"] != 1 {
+		t.Errorf("unexpected key goals %v", goals)
+	}
+
+	want := `# HELP bind_dnssec_policy_info dnssec-policy of the zone as reported by rndc dnssec -status.
+# TYPE bind_dnssec_policy_info gauge
+bind_dnssec_policy_info{policy="fast",view="external",zone="example.com"} 1
+bind_dnssec_policy_info{policy="standard",view="internal",zone="example.com"} 1
+# HELP bind_rndc_up Was the last rndc command successful?
+# TYPE bind_rndc_up gauge
+bind_rndc_up{command="dnssec"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want),
+		"bind_dnssec_policy_info", "bind_rndc_up"); err != nil {
+		t.Error(err)
+	}
+	if nextEvents != 1 {
+		t.Errorf("got %d next events, want 1", nextEvents)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+	"google.golang.org/protobuf/proto"
+)
+
+// dnstapBuckets range from 100µs, an answer from the cache, to 6.5s, a
+// resolution running into timeouts.
+var dnstapBuckets = prometheus.ExponentialBuckets(0.0001, 4, 9)
+
+// dnstapView maps clients in Net to View.
+type dnstapView struct {
+	View string
+	Net  *net.IPNet
+}
+
+// parseDNSTapView parses a view given as name=cidr.
+func parseDNSTapView(arg string) (dnstapView, error) {
+	i := strings.Index(arg, "=")
+	if i <= 0 {
+		return dnstapView{}, fmt.Errorf("View %q is not in name=cidr form", arg)
+	}
+	_, ipNet, err := net.ParseCIDR(arg[i+1:])
+	if err != nil {
+		return dnstapView{}, fmt.Errorf("View %q is not in name=cidr form: %s", arg, err)
+	}
+	return dnstapView{View: arg[:i], Net: ipNet}, nil
+}
+
+// qtypeName returns the mnemonic of a query type, other for types unknown
+// to the dns package to bound the number of series.
+func qtypeName(qtype uint16) string {
+	if name, ok := dns.TypeToString[qtype]; ok {
+		return name
+	}
+	return "other"
+}
+
+type dnstapCollector struct {
+	views []dnstapView
+
+	messages        *prometheus.CounterVec
+	decodeErrors    prometheus.Counter
+	clientLatency   *prometheus.HistogramVec
+	resolverLatency *prometheus.HistogramVec
+}
+
+// NewDNSTapCollector counts dnstap messages and observes the latency of
+// client and resolver responses. BIND doesn't send the view of a message, it
+// is taken from the first of views containing the client.
+func NewDNSTapCollector(views []dnstapView) *dnstapCollector {
+	return &dnstapCollector{
+		views: views,
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "dnstap",
+			Name:      "messages_total",
+			Help:      "dnstap messages received by type.",
+		}, []string{"type"}),
+		decodeErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "dnstap",
+			Name:      "decode_errors_total",
+			Help:      "dnstap frames or DNS messages in them that couldn't be decoded.",
+		}),
+		clientLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "dnstap",
+			Name:      "client_response_seconds",
+			Help:      "Time from receiving a client query to sending the response.",
+			Buckets:   dnstapBuckets,
+		}, []string{"view", "qtype", "rcode"}),
+		resolverLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "dnstap",
+			Name:      "resolver_response_seconds",
+			Help:      "Time from sending a query to an authoritative server to receiving the response.",
+			Buckets:   dnstapBuckets,
+		}, []string{"qtype", "rcode"}),
+	}
+}
+
+// Listen receives dnstap frames on the unix socket at path, which BIND
+// connects to as configured with dnstap-output unix.
+func (c *dnstapCollector) Listen(path string) error {
+	input, err := dnstap.NewFrameStreamSockInputFromPath(path)
+	if err != nil {
+		return fmt.Errorf("Can't listen for dnstap: %s", err)
+	}
+	input.SetLogger(dnstapLogger{})
+	input.SetTimeout(10 * time.Second)
+	frames := make(chan []byte, 1024)
+	go input.ReadInto(frames)
+	go func() {
+		for frame := range frames {
+			c.handle(frame)
+		}
+	}()
+	return nil
+}
+
+// Replay reads the frames of a file written with dnstap-output file.
+func (c *dnstapCollector) Replay(path string) error {
+	input, err := dnstap.NewFrameStreamInputFromFilename(path)
+	if err != nil {
+		return err
+	}
+	input.SetLogger(dnstapLogger{})
+	frames := make(chan []byte, 1024)
+	go func() {
+		input.ReadInto(frames)
+		close(frames)
+	}()
+	for frame := range frames {
+		c.handle(frame)
+	}
+	return nil
+}
+
+func (c *dnstapCollector) handle(frame []byte) {
+	dt := &dnstap.Dnstap{}
+	if err := proto.Unmarshal(frame, dt); err != nil || dt.GetType() != dnstap.Dnstap_MESSAGE || dt.GetMessage() == nil {
+		c.decodeErrors.Inc()
+		return
+	}
+	m := dt.GetMessage()
+	c.messages.WithLabelValues(strings.ToLower(m.GetType().String())).Inc()
+	switch m.GetType() {
+	case dnstap.Message_CLIENT_RESPONSE, dnstap.Message_RESOLVER_RESPONSE:
+	default:
+		return
+	}
+	if m.QueryTimeSec == nil || m.ResponseTimeSec == nil || m.ResponseMessage == nil {
+		return
+	}
+	msg := &dns.Msg{}
+	if err := msg.Unpack(m.GetResponseMessage()); err != nil {
+		c.decodeErrors.Inc()
+		return
+	}
+	qtype := "none"
+	if len(msg.Question) > 0 {
+		qtype = qtypeName(msg.Question[0].Qtype)
+	}
+	rcode, ok := dns.RcodeToString[msg.Rcode]
+	if !ok {
+		rcode = "other"
+	}
+	queryTime := time.Unix(int64(m.GetQueryTimeSec()), int64(m.GetQueryTimeNsec()))
+	latency := time.Unix(int64(m.GetResponseTimeSec()), int64(m.GetResponseTimeNsec())).Sub(queryTime)
+	if latency < 0 {
+		return
+	}
+	if m.GetType() == dnstap.Message_CLIENT_RESPONSE {
+		c.clientLatency.WithLabelValues(c.view(m.GetQueryAddress()), qtype, rcode).Observe(latency.Seconds())
+	} else {
+		c.resolverLatency.WithLabelValues(qtype, rcode).Observe(latency.Seconds())
+	}
+}
+
+// view returns the view of a client address, _default if no view contains
+// it.
+func (c *dnstapCollector) view(addr []byte) string {
+	ip := net.IP(addr)
+	for _, view := range c.views {
+		if view.Net.Contains(ip) {
+			return view.View
+		}
+	}
+	return "_default"
+}
+
+// Describe implements prometheus.Collector.
+func (c *dnstapCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.messages.Describe(ch)
+	c.decodeErrors.Describe(ch)
+	c.clientLatency.Describe(ch)
+	c.resolverLatency.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *dnstapCollector) Collect(ch chan<- prometheus.Metric) {
+	c.messages.Collect(ch)
+	c.decodeErrors.Collect(ch)
+	c.clientLatency.Collect(ch)
+	c.resolverLatency.Collect(ch)
+}
+
+// dnstapLogger passes the connection messages of the dnstap package to the
+// debug log.
+type dnstapLogger struct{}
+
+func (dnstapLogger) Printf(format string, v ...interface{}) {
+	log.Debugf(strings.TrimSuffix(format, "\n"), v...)
+}
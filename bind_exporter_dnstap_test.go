@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	dnstap "github.com/dnstap/golang-dnstap"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testdata/bind.dnstap is in the format of dnstap-output file, with client
+// responses of 0.5ms, 2ms and 3s and a resolver response of 30ms.
+func Test_DNSTapCollectorReplay(t *testing.T) {
+
+	_, internal, _ := net.ParseCIDR("192.0.2.0/24")
+	collector := NewDNSTapCollector([]dnstapView{{View: "internal", Net: internal}})
+	if err := collector.Replay("testdata/bind.dnstap"); err != nil {
+		t.Fatal(err)
+	}
+	collector.handle([]byte("not a dnstap frame"))
+
+	want := `# HELP bind_dnstap_decode_errors_total dnstap frames or DNS messages in them that couldn't be decoded.
+# TYPE bind_dnstap_decode_errors_total counter
+bind_dnstap_decode_errors_total 1
+# HELP bind_dnstap_messages_total dnstap messages received by type.
+# TYPE bind_dnstap_messages_total counter
+bind_dnstap_messages_total{type="client_query"} 2
+bind_dnstap_messages_total{type="client_response"} 3
+bind_dnstap_messages_total{type="resolver_query"} 1
+bind_dnstap_messages_total{type="resolver_response"} 1
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want), "bind_dnstap_decode_errors_total", "bind_dnstap_messages_total"); err != nil {
+		t.Error(err)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]float64{}
+	for _, mf := range mfs {
+		if !strings.HasSuffix(mf.GetName(), "_response_seconds") {
+			continue
+		}
+		for _, m := range mf.GetMetric() {
+			var labels []string
+			for _, l := range m.GetLabel() {
+				labels = append(labels, l.GetValue())
+			}
+			got[mf.GetName()+"/"+strings.Join(labels, "/")] = m.GetHistogram().GetSampleSum()
+		}
+	}
+	for key, sum := range map[string]float64{
+		"bind_dnstap_client_response_seconds/A/NOERROR/internal":     0.0005,
+		"bind_dnstap_client_response_seconds/AAAA/NXDOMAIN/_default": 0.002,
+		"bind_dnstap_client_response_seconds/A/SERVFAIL/internal":    3,
+		"bind_dnstap_resolver_response_seconds/A/NOERROR":            0.03,
+	} {
+		if v, ok := got[key]; !ok || v < sum*0.999 || v > sum*1.001 {
+			t.Errorf("%s = %v, want %v", key, v, sum)
+		}
+	}
+	if len(got) != 4 {
+		t.Errorf("unexpected histograms %v", got)
+	}
+}
+
+func Test_DNSTapCollectorListen(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "dnstap.sock")
+	collector := NewDNSTapCollector(nil)
+	if err := collector.Listen(path); err != nil {
+		t.Fatal(err)
+	}
+	input, err := dnstap.NewFrameStreamInputFromFilename("testdata/bind.dnstap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := dnstap.NewFrameStreamSockOutput(&net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go output.RunOutputLoop()
+	input.ReadInto(output.GetOutputChannel())
+	output.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(collector.messages.WithLabelValues("client_response")) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("dnstap messages not received over the socket")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// 19-Oct-2026 10:00:00.000 lame-servers: info: lame server resolving ...
+	logPrefixReg = regexp.MustCompile(`(?:^|\s)(?:([a-z][a-z0-9-]*): )?(critical|error|warning|notice|info|debug(?: \d+)?|dynamic): `)
+
+	logEvents = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "log", "events_total"),
+		"Lines of the named log matching a rule, by the category and severity printed in the line.",
+		[]string{"category", "severity", "rule"}, nil,
+	)
+
+	// defaultLogRules are the log events worth counting on most servers.
+	defaultLogRules = []LogRule{
+		{Name: "lame-server", Regex: `lame server resolving`},
+		{Name: "edns-disabled", Regex: `disabling EDNS|reducing the advertised EDNS UDP packet size`},
+		{Name: "zone-transfer-failed", Regex: `transfer of '[^']*' from \S+: failed`},
+		{Name: "too-many-records", Regex: `too many records`},
+		{Name: "rate-limit", Regex: `rate limit (?:drop|slip)`},
+	}
+)
+
+// LogRule counts the lines of the named log matching Regex, only in
+// Category if set.
+type LogRule struct {
+	Name     string `json:"name"`
+	Regex    string `json:"regex"`
+	Category string `json:"category,omitempty"`
+
+	reg *regexp.Regexp
+}
+
+// loadLogRules returns the default rules and those of the JSON file at path,
+// which replace default rules of the same name.
+func loadLogRules(path string) ([]LogRule, error) {
+	rules := append([]LogRule{}, defaultLogRules...)
+	if path != "" {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("Can't read log rules: %s", err)
+		}
+		var fileRules []LogRule
+		if err := json.Unmarshal(content, &fileRules); err != nil {
+			return nil, fmt.Errorf("Can't parse log rules %s: %s", path, err)
+		}
+	next:
+		for _, rule := range fileRules {
+			if rule.Name == "" {
+				return nil, fmt.Errorf("Log rule %q in %s has no name", rule.Regex, path)
+			}
+			for i := range rules {
+				if rules[i].Name == rule.Name {
+					rules[i] = rule
+					continue next
+				}
+			}
+			rules = append(rules, rule)
+		}
+	}
+	for i := range rules {
+		reg, err := regexp.Compile(rules[i].Regex)
+		if err != nil {
+			return nil, fmt.Errorf("Can't compile log rule %s: %s", rules[i].Name, err)
+		}
+		rules[i].reg = reg
+	}
+	return rules, nil
+}
+
+// parseLogPrefix returns the category and severity named prints before the
+// message with print-category and print-severity, empty if not printed.
+func parseLogPrefix(line string) (category, severity string) {
+	m := logPrefixReg.FindStringSubmatch(line)
+	if m == nil {
+		return "", ""
+	}
+	return m[1], strings.Fields(m[2])[0]
+}
+
+type logEventKey struct {
+	category, severity, rule string
+}
+
+type logCollector struct {
+	rules []LogRule
+	tail  *tailer
+
+	mu     sync.Mutex
+	events map[logEventKey]float64
+}
+
+// NewLogCollector counts the lines of the named log at path matching rules.
+// A line is counted once for every rule it matches. Poll has to be called
+// regularly to follow the file.
+func NewLogCollector(path string, rules []LogRule) *logCollector {
+	return &logCollector{
+		rules:  rules,
+		tail:   newTailer(path),
+		events: map[logEventKey]float64{},
+	}
+}
+
+// Poll reads the lines appended to the log since the last poll.
+func (c *logCollector) Poll() error {
+	return c.tail.poll(func(line string) {
+		category, severity := parseLogPrefix(line)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, rule := range c.rules {
+			if rule.Category != "" && rule.Category != category {
+				continue
+			}
+			if rule.reg.MatchString(line) {
+				c.events[logEventKey{category, severity, rule.Name}]++
+			}
+		}
+	})
+}
+
+// Describe implements prometheus.Collector.
+func (c *logCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- logEvents
+}
+
+// Collect implements prometheus.Collector.
+func (c *logCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, v := range c.events {
+		ch <- prometheus.MustNewConstMetric(logEvents, prometheus.CounterValue, v, key.category, key.severity, key.rule)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_LoadLogRules(t *testing.T) {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "rules.json")
+	write := func(content string) {
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`[
+		{"name": "rate-limit", "regex": "rate limit \\w+"},
+		{"name": "notify-refused", "regex": "refused notify", "category": "notify"}
+	]`)
+	rules, err := loadLogRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != len(defaultLogRules)+1 {
+		t.Fatalf("got %d rules, want %d", len(rules), len(defaultLogRules)+1)
+	}
+	for _, rule := range rules {
+		if rule.Name == "rate-limit" && rule.Regex != `rate limit \w+` {
+			t.Errorf("default rule not replaced: %q", rule.Regex)
+		}
+	}
+
+	for _, content := range []string{`[{"name": "broken", "regex": "("}]`, `[{"regex": "x"}]`, `{`} {
+		write(content)
+		if _, err := loadLogRules(path); err == nil {
+			t.Errorf("no error for %s", content)
+		}
+	}
+}
+
+func Test_LogCollector(t *testing.T) {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "named.log")
+	if err := ioutil.WriteFile(path, []byte("lame-servers: info: lame server resolving 'old.example' (in 'example'?): 192.0.2.1#53\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rulesFile := filepath.Join(dir, "rules.json")
+	if err := ioutil.WriteFile(rulesFile, []byte(`[{"name": "refused", "regex": "REFUSED", "category": "xfer-in"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := loadLogRules(rulesFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector := NewLogCollector(path, rules)
+	if err := collector.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"19-Oct-2026 10:00:00.000 lame-servers: info: lame server resolving 'www.example' (in 'example'?): 192.0.2.1#53",
+		"19-Oct-2026 10:00:01.000 lame-servers: info: lame server resolving 'mail.example' (in 'example'?): 192.0.2.1#53",
+		"19-Oct-2026 10:00:02.000 edns-disabled: info: success resolving 'www.example/A' (in 'example'?) after disabling EDNS",
+		"19-Oct-2026 10:00:03.000 xfer-in: error: transfer of 'example.com/IN' from 192.0.2.1#53: failed while receiving responses: REFUSED",
+		"19-Oct-2026 10:00:04.000 general: error: zone example.com/IN: REFUSED",
+		"19-Oct-2026 10:00:05.000 rate-limit: info: rate limit drop response to 198.51.100.0/24 for example.com IN A  (00800004)",
+		"rate limit slip response to 198.51.100.0/24 for example.com IN A  (00800004)",
+	} {
+		fmt.Fprintln(f, line)
+	}
+	f.Close()
+	if err := collector.Poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP bind_log_events_total Lines of the named log matching a rule, by the category and severity printed in the line.
+# TYPE bind_log_events_total counter
+bind_log_events_total{category="",rule="rate-limit",severity=""} 1
+bind_log_events_total{category="edns-disabled",rule="edns-disabled",severity="info"} 1
+bind_log_events_total{category="lame-servers",rule="lame-server",severity="info"} 2
+bind_log_events_total{category="rate-limit",rule="rate-limit",severity="info"} 1
+bind_log_events_total{category="xfer-in",rule="refused",severity="error"} 1
+bind_log_events_total{category="xfer-in",rule="zone-transfer-failed",severity="error"} 1
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
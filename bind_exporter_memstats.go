@@ -0,0 +1,112 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	memSizeReg    = regexp.MustCompile(`^\s*(?:>=)?\s*(\d+):\s+(\d+) gets,\s+(\d+) rem`)
+	memContextReg = regexp.MustCompile(`^context: \S+ \((.*)\): (\d+) references`)
+	memActiveReg  = regexp.MustCompile(`^\s*ptr \S+ size (\d+) `)
+
+	memoryContextBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "memory", "context_bytes"),
+		"Memory in use by the contexts of a name in the memstatistics-file.",
+		[]string{"context"}, nil,
+	)
+	memoryTotalBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "memory", "total_bytes"),
+		"Memory in use by all contexts in the memstatistics-file.",
+		nil, nil,
+	)
+	memoryContexts = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "memory", "contexts"),
+		"Number of memory contexts in the memstatistics-file.",
+		nil, nil,
+	)
+	memoryDumpTimestamp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "memory", "dump_timestamp_seconds"),
+		"Time the memstatistics-file was written since unix epoch in seconds.",
+		nil, nil,
+	)
+)
+
+// MemContext is a memory context in the memstatistics-file.
+type MemContext struct {
+	Name       string  `json:"name"`
+	References float64 `json:"references"`
+	Bytes      float64 `json:"bytes"`
+}
+
+// MemStats is the parsed memstatistics-file.
+type MemStats struct {
+	DumpTime int64         `json:"dump_time"`
+	Contexts []*MemContext `json:"contexts"`
+}
+
+// ParserMemStats parses the memstatistics-file, which named writes on
+// shutdown. It starts with the size table of the main context, followed by
+// the outstanding allocations of the contexts still alive. The size table
+// is used where present, as the allocations are only listed when named is
+// built with memory tracking.
+func ParserMemStats(content string) *MemStats {
+	stats := &MemStats{}
+	ctx := &MemContext{Name: "main"}
+	table, active, sized := 0.0, 0.0, false
+	flush := func() {
+		if sized {
+			ctx.Bytes = table
+		} else {
+			ctx.Bytes = active
+		}
+		if sized || active > 0 || ctx.Name != "main" {
+			stats.Contexts = append(stats.Contexts, ctx)
+		}
+	}
+	for _, line := range strings.Split(content, "\n") {
+		if m := memContextReg.FindStringSubmatch(line); m != nil {
+			flush()
+			ctx = &MemContext{Name: m[1]}
+			if ctx.Name == "" {
+				ctx.Name = "<unknown>"
+			}
+			ctx.References, _ = strconv.ParseFloat(m[2], 64)
+			table, active, sized = 0, 0, false
+		} else if m := memSizeReg.FindStringSubmatch(line); m != nil {
+			size, _ := strconv.ParseFloat(m[1], 64)
+			rem, _ := strconv.ParseFloat(m[3], 64)
+			table += size * rem
+			sized = true
+		} else if m := memActiveReg.FindStringSubmatch(line); m != nil {
+			size, _ := strconv.ParseFloat(m[1], 64)
+			active += size
+		}
+	}
+	flush()
+	return stats
+}
+
+// collectMemStats exports the memstatistics-file, summing up the contexts
+// of the same name, such as the caches of several views.
+func collectMemStats(ch chan<- prometheus.Metric, mem *MemStats) {
+	var names []string
+	bytes := map[string]float64{}
+	total := 0.0
+	for _, ctx := range mem.Contexts {
+		if _, ok := bytes[ctx.Name]; !ok {
+			names = append(names, ctx.Name)
+		}
+		bytes[ctx.Name] += ctx.Bytes
+		total += ctx.Bytes
+	}
+	for _, name := range names {
+		ch <- prometheus.MustNewConstMetric(memoryContextBytes, prometheus.GaugeValue, bytes[name], name)
+	}
+	ch <- prometheus.MustNewConstMetric(memoryTotalBytes, prometheus.GaugeValue, total)
+	ch <- prometheus.MustNewConstMetric(memoryContexts, prometheus.GaugeValue, float64(len(mem.Contexts)))
+	ch <- prometheus.MustNewConstMetric(memoryDumpTimestamp, prometheus.GaugeValue, float64(mem.DumpTime))
+}
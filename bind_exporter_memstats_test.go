@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_ParserMemStats(t *testing.T) {
+
+	content, err := ioutil.ReadFile("testdata/named.memstats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats := ParserMemStats(string(content))
+	if len(stats.Contexts) != 4 {
+		t.Fatalf("got %d contexts, want 4", len(stats.Contexts))
+	}
+	for i, want := range []MemContext{
+		{Name: "main", Bytes: 16*1024 + 32*2048 + 64*10 + 1024*4 + 1100*2},
+		{Name: "cache", References: 2, Bytes: 4096 + 1024},
+		{Name: "cache", References: 1, Bytes: 512},
+		{Name: "<unknown>", References: 1},
+	} {
+		if *stats.Contexts[i] != want {
+			t.Errorf("context %d = %+v, want %+v", i, *stats.Contexts[i], want)
+		}
+	}
+}
+
+func Test_StatsCollectorMemStats(t *testing.T) {
+
+	dir := t.TempDir()
+	statsFile := filepath.Join(dir, "named.stats")
+	if err := ioutil.WriteFile(statsFile, []byte(str), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(dir, "stats.sh")
+	if err := ioutil.WriteFile(script, []byte("true\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	collector := NewStatsCollector(StatsCollectorOpts{
+		FilePath:     statsFile,
+		Script:       script,
+		MemStatsFile: "testdata/named.memstats",
+	})
+	want := `# HELP bind_memory_context_bytes Memory in use by the contexts of a name in the memstatistics-file.
+# TYPE bind_memory_context_bytes gauge
+bind_memory_context_bytes{context="<unknown>"} 0
+bind_memory_context_bytes{context="cache"} 5632
+bind_memory_context_bytes{context="main"} 88856
+# HELP bind_memory_contexts Number of memory contexts in the memstatistics-file.
+# TYPE bind_memory_contexts gauge
+bind_memory_contexts 4
+# HELP bind_memory_total_bytes Memory in use by all contexts in the memstatistics-file.
+# TYPE bind_memory_total_bytes gauge
+bind_memory_total_bytes 94488
+# HELP bind_up Was the Bind instance query successful?
+# TYPE bind_up gauge
+bind_up 1
+`
+	names := []string{"bind_memory_context_bytes", "bind_memory_contexts", "bind_memory_total_bytes", "bind_up"}
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want), names...); err != nil {
+		t.Error(err)
+	}
+
+	// named hasn't written the file yet, the statistics are still exported
+	collector = NewStatsCollector(StatsCollectorOpts{
+		FilePath:     statsFile,
+		Script:       script,
+		MemStatsFile: filepath.Join(dir, "named.memstats"),
+	})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	want = `# HELP bind_up Was the Bind instance query successful?
+# TYPE bind_up gauge
+bind_up 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want), append(names, "bind_memory_dump_timestamp_seconds")...); err != nil {
+		t.Error(err)
+	}
+}
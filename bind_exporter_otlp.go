@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+	"github.com/prometheus/common/version"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// OTLPOpts defines how metrics are exported to an OpenTelemetry collector.
+type OTLPOpts struct {
+	// Endpoint is host:port for gRPC. For HTTP it may also be a full URL,
+	// /v1/metrics is used when it has no path or just /.
+	Endpoint string
+	// Protocol is either "http" or "grpc".
+	Protocol string
+	Insecure bool
+	Timeout  time.Duration
+	Headers  map[string]string
+	// ResourceAttributes describe the exporting host, e.g. host.name and
+	// service.instance.id.
+	ResourceAttributes map[string]string
+}
+
+type otlpExporter struct {
+	opts     OTLPOpts
+	gatherer prometheus.Gatherer
+	starts   *seriesStarts
+	url      string
+	client   *http.Client
+	conn     *grpc.ClientConn
+	service  colmetricspb.MetricsServiceClient
+}
+
+// NewOTLPExporter returns an exporter that translates everything gathered
+// from g into OTLP metrics.
+func NewOTLPExporter(opts OTLPOpts, g prometheus.Gatherer) (*otlpExporter, error) {
+	e := &otlpExporter{
+		opts:     opts,
+		gatherer: g,
+		starts:   newSeriesStarts(time.Now()),
+	}
+	switch opts.Protocol {
+	case "http":
+		e.url = opts.Endpoint
+		if !strings.Contains(e.url, "://") {
+			if opts.Insecure {
+				e.url = "http://" + e.url
+			} else {
+				e.url = "https://" + e.url
+			}
+		}
+		u, err := url.Parse(e.url)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid OTLP endpoint %q: %s", opts.Endpoint, err)
+		}
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/v1/metrics"
+		}
+		e.url = u.String()
+		e.client = &http.Client{Timeout: opts.Timeout}
+	case "grpc":
+		creds := credentials.NewTLS(&tls.Config{})
+		if opts.Insecure {
+			creds = insecure.NewCredentials()
+		}
+		conn, err := grpc.NewClient(opts.Endpoint, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return nil, err
+		}
+		e.conn = conn
+		e.service = colmetricspb.NewMetricsServiceClient(conn)
+	default:
+		return nil, fmt.Errorf("Unknown OTLP protocol %q, want http or grpc", opts.Protocol)
+	}
+	return e, nil
+}
+
+// Export gathers the current metrics and sends them in one request.
+func (e *otlpExporter) Export() error {
+	mfs, err := e.gatherer.Gather()
+	if err != nil {
+		log.Error(err)
+	}
+	req := &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: &resourcepb.Resource{Attributes: toKeyValues(e.opts.ResourceAttributes)},
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Scope:   &commonpb.InstrumentationScope{Name: EXPORTER, Version: version.Version},
+				Metrics: toOTLPMetrics(mfs, e.starts, time.Now()),
+			}},
+		}},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), e.opts.Timeout)
+	defer cancel()
+	if e.service != nil {
+		if len(e.opts.Headers) > 0 {
+			ctx = metadata.NewOutgoingContext(ctx, metadata.New(e.opts.Headers))
+		}
+		resp, err := e.service.Export(ctx, req)
+		if err != nil {
+			return err
+		}
+		if rejected := resp.GetPartialSuccess().GetRejectedDataPoints(); rejected > 0 {
+			log.Warnf("OTLP receiver rejected %d data points: %s", rejected, resp.GetPartialSuccess().GetErrorMessage())
+		}
+		return nil
+	}
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	httpReq.Header.Set("User-Agent", EXPORTER)
+	for name, value := range e.opts.Headers {
+		httpReq.Header.Set(name, value)
+	}
+	resp, err := e.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status code %d while exporting to %s: %s", resp.StatusCode, e.url, msg)
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+// seriesStarts keeps the start time of every cumulative series across
+// exports. A series starts when the exporter starts, or when it is first
+// observed if that is earlier, and starts again when its value goes down, as
+// after a restart of named.
+type seriesStarts struct {
+	start  uint64
+	series map[string]*seriesStart
+}
+
+type seriesStart struct {
+	start    uint64
+	lastTime uint64
+	value    float64
+}
+
+func newSeriesStarts(start time.Time) *seriesStarts {
+	return &seriesStarts{start: uint64(start.UnixNano()), series: map[string]*seriesStart{}}
+}
+
+// observe records the value of a series at timeNano and returns its start.
+func (s *seriesStarts) observe(key string, value float64, timeNano uint64) uint64 {
+	st, ok := s.series[key]
+	if !ok {
+		st = &seriesStart{start: s.start}
+		if st.start > timeNano {
+			st.start = timeNano
+		}
+		s.series[key] = st
+	} else if value < st.value {
+		// reset between the last and this observation
+		st.start = st.lastTime
+	}
+	st.lastTime, st.value = timeNano, value
+	return st.start
+}
+
+// seriesKey identifies a series by its name and labels.
+func seriesKey(name string, m *dto.Metric) string {
+	key := name
+	for _, l := range m.GetLabel() {
+		key += "\xff" + l.GetName() + "\xff" + l.GetValue()
+	}
+	return key
+}
+
+// toOTLPMetrics maps Prometheus metric families onto OTel instruments:
+// counters become cumulative monotonic sums, gauges stay gauges and
+// histograms become explicit-bucket histograms. The start times of the
+// cumulative series are kept in starts.
+func toOTLPMetrics(mfs []*dto.MetricFamily, starts *seriesStarts, now time.Time) []*metricspb.Metric {
+	var metrics []*metricspb.Metric
+	for _, mf := range mfs {
+		metric := &metricspb.Metric{Name: mf.GetName(), Description: mf.GetHelp()}
+		var (
+			numbers    []*metricspb.NumberDataPoint
+			histograms []*metricspb.HistogramDataPoint
+			summaries  []*metricspb.SummaryDataPoint
+		)
+		for _, m := range mf.GetMetric() {
+			attrs := make([]*commonpb.KeyValue, 0, len(m.GetLabel()))
+			for _, l := range m.GetLabel() {
+				attrs = append(attrs, stringKeyValue(l.GetName(), l.GetValue()))
+			}
+			timeNano := uint64(now.UnixNano())
+			if m.TimestampMs != nil {
+				timeNano = uint64(m.GetTimestampMs()) * uint64(time.Millisecond)
+			}
+			startNano := starts.start
+			if startNano > timeNano {
+				startNano = timeNano
+			}
+			key := seriesKey(mf.GetName(), m)
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER, dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+				value := m.GetGauge().GetValue()
+				if mf.GetType() == dto.MetricType_COUNTER {
+					value = m.GetCounter().GetValue()
+				} else if mf.GetType() == dto.MetricType_UNTYPED {
+					value = m.GetUntyped().GetValue()
+				}
+				if mf.GetType() == dto.MetricType_COUNTER {
+					startNano = starts.observe(key, value, timeNano)
+				}
+				numbers = append(numbers, &metricspb.NumberDataPoint{
+					Attributes:        attrs,
+					StartTimeUnixNano: startNano,
+					TimeUnixNano:      timeNano,
+					Value:             &metricspb.NumberDataPoint_AsDouble{AsDouble: value},
+				})
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				dp := &metricspb.HistogramDataPoint{
+					Attributes:        attrs,
+					StartTimeUnixNano: starts.observe(key, float64(h.GetSampleCount()), timeNano),
+					TimeUnixNano:      timeNano,
+					Count:             h.GetSampleCount(),
+				}
+				if sum := h.GetSampleSum(); !math.IsNaN(sum) {
+					dp.Sum = &sum
+				}
+				var cumulative uint64
+				for _, b := range h.GetBucket() {
+					if math.IsInf(b.GetUpperBound(), 1) {
+						continue
+					}
+					dp.ExplicitBounds = append(dp.ExplicitBounds, b.GetUpperBound())
+					dp.BucketCounts = append(dp.BucketCounts, b.GetCumulativeCount()-cumulative)
+					cumulative = b.GetCumulativeCount()
+				}
+				dp.BucketCounts = append(dp.BucketCounts, h.GetSampleCount()-cumulative)
+				histograms = append(histograms, dp)
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				dp := &metricspb.SummaryDataPoint{
+					Attributes:        attrs,
+					StartTimeUnixNano: starts.observe(key, float64(s.GetSampleCount()), timeNano),
+					TimeUnixNano:      timeNano,
+					Count:             s.GetSampleCount(),
+					Sum:               s.GetSampleSum(),
+				}
+				for _, q := range s.GetQuantile() {
+					dp.QuantileValues = append(dp.QuantileValues, &metricspb.SummaryDataPoint_ValueAtQuantile{
+						Quantile: q.GetQuantile(),
+						Value:    q.GetValue(),
+					})
+				}
+				summaries = append(summaries, dp)
+			}
+		}
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			metric.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+				DataPoints:             numbers,
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				IsMonotonic:            true,
+			}}
+		case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+			metric.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: numbers}}
+		case dto.MetricType_HISTOGRAM:
+			metric.Data = &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+				DataPoints:             histograms,
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			}}
+		case dto.MetricType_SUMMARY:
+			metric.Data = &metricspb.Metric_Summary{Summary: &metricspb.Summary{DataPoints: summaries}}
+		default:
+			continue
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+func toKeyValues(attrs map[string]string) []*commonpb.KeyValue {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	kvs := make([]*commonpb.KeyValue, 0, len(keys))
+	for _, key := range keys {
+		kvs = append(kvs, stringKeyValue(key, attrs[key]))
+	}
+	return kvs
+}
+
+func stringKeyValue(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
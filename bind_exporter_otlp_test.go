@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// otlpReceiverStub accepts OTLP/HTTP and OTLP/gRPC exports.
+type otlpReceiverStub struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	mu       sync.Mutex
+	requests []*colmetricspb.ExportMetricsServiceRequest
+	headers  []map[string]string
+}
+
+func (s *otlpReceiverStub) record(req *colmetricspb.ExportMetricsServiceRequest, headers map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, req)
+	s.headers = append(s.headers, headers)
+}
+
+func (s *otlpReceiverStub) Export(ctx context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.record(req, map[string]string{"x-tenant": firstValue(md.Get("x-tenant"))})
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+func (s *otlpReceiverStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/metrics" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	req := &colmetricspb.ExportMetricsServiceRequest{}
+	if err := proto.Unmarshal(body, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.record(req, map[string]string{"x-tenant": r.Header.Get("X-Tenant")})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+}
+
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func newOTLPRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&parsedStatsCollector{statsInfo: ParserStats(str)})
+	return registry
+}
+
+func checkOTLPRequest(t *testing.T, stub *otlpReceiverStub) {
+	if len(stub.requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(stub.requests))
+	}
+	if stub.headers[0]["x-tenant"] != "dns" {
+		t.Errorf("header x-tenant = %q, want dns", stub.headers[0]["x-tenant"])
+	}
+	rm := stub.requests[0].GetResourceMetrics()[0]
+	attrs := map[string]string{}
+	for _, kv := range rm.GetResource().GetAttributes() {
+		attrs[kv.GetKey()] = kv.GetValue().GetStringValue()
+	}
+	if attrs["host.name"] != "ns1" || attrs["service.instance.id"] != "ns1:9219" {
+		t.Errorf("resource attributes = %v", attrs)
+	}
+	metrics := map[string]*metricspb.Metric{}
+	for _, m := range rm.GetScopeMetrics()[0].GetMetrics() {
+		metrics[m.GetName()] = m
+	}
+
+	sum := metrics["bind_incoming_queries_total"].GetSum()
+	if sum == nil || !sum.GetIsMonotonic() ||
+		sum.GetAggregationTemporality() != metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+		t.Errorf("bind_incoming_queries_total is not a cumulative monotonic sum: %v", metrics["bind_incoming_queries_total"])
+	}
+	if metrics["bind_stats_dump_timestamp_seconds"].GetGauge() == nil {
+		t.Error("bind_stats_dump_timestamp_seconds is not a gauge")
+	}
+	histogram := metrics["bind_resolver_stats_queries_with_rtt_milliseconds_histogram"].GetHistogram()
+	if histogram == nil {
+		t.Fatal("RTT histogram missing")
+	}
+	for _, dp := range histogram.GetDataPoints() {
+		if len(dp.GetBucketCounts()) != len(dp.GetExplicitBounds())+1 {
+			t.Errorf("%d buckets for %d bounds", len(dp.GetBucketCounts()), len(dp.GetExplicitBounds()))
+		}
+		var total uint64
+		for _, c := range dp.GetBucketCounts() {
+			total += c
+		}
+		if total != dp.GetCount() {
+			t.Errorf("bucket counts add up to %d, want %d", total, dp.GetCount())
+		}
+		if dp.Sum != nil {
+			t.Errorf("unexpected sum %v", dp.GetSum())
+		}
+		if dp.GetAttributes()[0].GetValue().GetStringValue() == "view_bj_ali" && dp.GetBucketCounts()[0] != 134115772 {
+			t.Errorf("first bucket = %d, want 134115772", dp.GetBucketCounts()[0])
+		}
+	}
+}
+
+var otlpTestOpts = OTLPOpts{
+	Insecure: true,
+	Timeout:  5 * time.Second,
+	Headers:  map[string]string{"X-Tenant": "dns"},
+	ResourceAttributes: map[string]string{
+		"host.name":           "ns1",
+		"service.instance.id": "ns1:9219",
+	},
+}
+
+func Test_OTLPExporterHTTP(t *testing.T) {
+
+	stub := &otlpReceiverStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	opts := otlpTestOpts
+	opts.Protocol = "http"
+	opts.Endpoint = server.URL
+	exporter, err := NewOTLPExporter(opts, newOTLPRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.Export(); err != nil {
+		t.Fatal(err)
+	}
+	checkOTLPRequest(t, stub)
+}
+
+func Test_OTLPEndpointURL(t *testing.T) {
+
+	for endpoint, want := range map[string]string{
+		"collector:4318":                  "https://collector:4318/v1/metrics",
+		"http://collector:4318":           "http://collector:4318/v1/metrics",
+		"http://collector:4318/":          "http://collector:4318/v1/metrics",
+		"http://collector:4318/otlp/v1/m": "http://collector:4318/otlp/v1/m",
+	} {
+		exporter, err := NewOTLPExporter(OTLPOpts{Endpoint: endpoint, Protocol: "http"}, prometheus.NewRegistry())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exporter.url != want {
+			t.Errorf("%s: url = %s, want %s", endpoint, exporter.url, want)
+		}
+	}
+}
+
+func Test_OTLPExporterGRPC(t *testing.T) {
+
+	stub := &otlpReceiverStub{}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	colmetricspb.RegisterMetricsServiceServer(server, stub)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	opts := otlpTestOpts
+	opts.Protocol = "grpc"
+	opts.Endpoint = listener.Addr().String()
+	exporter, err := NewOTLPExporter(opts, newOTLPRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.Export(); err != nil {
+		t.Fatal(err)
+	}
+	checkOTLPRequest(t, stub)
+}
+
+// sumStarts returns the start and point times of the data points of a sum,
+// keyed by their attributes.
+func sumStarts(req *colmetricspb.ExportMetricsServiceRequest, name string) map[string][2]uint64 {
+	starts := map[string][2]uint64{}
+	for _, m := range req.GetResourceMetrics()[0].GetScopeMetrics()[0].GetMetrics() {
+		if m.GetName() != name {
+			continue
+		}
+		for _, dp := range m.GetSum().GetDataPoints() {
+			key := ""
+			for _, kv := range dp.GetAttributes() {
+				key += kv.GetKey() + "=" + kv.GetValue().GetStringValue() + ","
+			}
+			starts[key] = [2]uint64{dp.GetStartTimeUnixNano(), dp.GetTimeUnixNano()}
+		}
+	}
+	return starts
+}
+
+func Test_OTLPStartTime(t *testing.T) {
+
+	stub := &otlpReceiverStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	collector := &parsedStatsCollector{
+		statsCollector: statsCollector{dumpTimestamp: true},
+		statsInfo:      ParserStats(str),
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	opts := otlpTestOpts
+	opts.Protocol = "http"
+	opts.Endpoint = server.URL
+	exporter, err := NewOTLPExporter(opts, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// every dump carries a new header timestamp and, unless named restarted,
+	// larger counters
+	dump := func(offset int64, delta float64) {
+		statsInfo := ParserStats(str)
+		statsInfo.BootTime += offset
+		statsInfo.DumpTime += offset
+		for _, md := range statsInfo.ModuleMap["Incoming Queries"] {
+			for name, value := range md.Info {
+				md.Info[name] = value + delta
+			}
+		}
+		collector.statsInfo = statsInfo
+		if err := exporter.Export(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dump(0, 0)
+	dump(60, 10)
+	dump(120, -1)
+
+	const name = "bind_incoming_queries_total"
+	first, second, restarted := sumStarts(stub.requests[0], name), sumStarts(stub.requests[1], name), sumStarts(stub.requests[2], name)
+	if len(first) == 0 {
+		t.Fatalf("no %s exported", name)
+	}
+	for key, points := range first {
+		if points[0] > points[1] {
+			t.Errorf("%s: start %d after time %d", key, points[0], points[1])
+		}
+		if second[key][0] != points[0] {
+			t.Errorf("%s: start moved from %d to %d between two dumps", key, points[0], second[key][0])
+		}
+		if restarted[key][0] != second[key][1] {
+			t.Errorf("%s: start after the restart = %d, want the time of the last dump %d", key, restarted[key][0], second[key][1])
+		}
+	}
+}
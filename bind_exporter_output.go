@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// maxDatagramSize keeps UDP payloads below a typical MTU.
+const maxDatagramSize = 1400
+
+// statsEncoder renders a parsed dump in a line based wire format.
+type statsEncoder func(w io.Writer, host string, statsInfo *StatusInfo, now time.Time) error
+
+// statsOutput periodically sends the parsed dump to an InfluxDB or Graphite
+// compatible listener, or writes it to a file.
+type statsOutput struct {
+	scheme  string
+	address string
+	host    string
+	encode  statsEncoder
+	scrape  func() (*StatusInfo, error)
+	timeout time.Duration
+}
+
+// NewStatsOutput returns an output writing to target, which is one of
+// udp://host:port, tcp://host:port or file:///path.
+func NewStatsOutput(target, host string, encode statsEncoder, scrape func() (*StatusInfo, error)) (*statsOutput, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	o := &statsOutput{
+		scheme:  u.Scheme,
+		address: u.Host,
+		host:    host,
+		encode:  encode,
+		scrape:  scrape,
+		timeout: 10 * time.Second,
+	}
+	switch u.Scheme {
+	case "udp", "tcp":
+		if u.Host == "" {
+			return nil, fmt.Errorf("Output %s has no host:port", target)
+		}
+	case "file":
+		o.address = u.Path
+	default:
+		return nil, fmt.Errorf("Unknown output %s, want udp://, tcp:// or file://", target)
+	}
+	return o, nil
+}
+
+// Write runs the trigger, parses the dump and sends it.
+func (o *statsOutput) Write() error {
+	statsInfo, err := o.scrape()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := o.encode(&buf, o.host, statsInfo, time.Now()); err != nil {
+		return err
+	}
+	switch o.scheme {
+	case "udp":
+		return o.writeUDP(buf.Bytes())
+	case "tcp":
+		conn, err := net.DialTimeout("tcp", o.address, o.timeout)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		conn.SetWriteDeadline(time.Now().Add(o.timeout))
+		_, err = conn.Write(buf.Bytes())
+		return err
+	default:
+		return writeFileAtomic(o.address, buf.Bytes())
+	}
+}
+
+// writeUDP sends data in datagrams of whole lines.
+func (o *statsOutput) writeUDP(data []byte) error {
+	conn, err := net.DialTimeout("udp", o.address, o.timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for len(data) > 0 {
+		end := len(data)
+		if end > maxDatagramSize {
+			end = bytes.LastIndexByte(data[:maxDatagramSize], '\n') + 1
+			if end == 0 {
+				end = bytes.IndexByte(data, '\n') + 1
+				if end == 0 {
+					end = len(data)
+				}
+			}
+		}
+		if _, err := conn.Write(data[:end]); err != nil {
+			return err
+		}
+		data = data[end:]
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data, so that readers never see a
+// partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// EncodeInflux writes one InfluxDB line per section and view, e.g.
+// bind_resolver_statistics,host=ns1,view=internal query_retries=3 1598003941000000000
+func EncodeInflux(w io.Writer, host string, statsInfo *StatusInfo, now time.Time) error {
+	ts := dumpTime(statsInfo, now).UnixNano()
+	for _, section := range sortedSections(statsInfo) {
+		measurement := influxEscape(namespace+"_"+strings.ToLower(metricComponent(section)), ", ")
+		for _, md := range statsInfo.ModuleMap[section] {
+			if len(md.Info) == 0 {
+				continue
+			}
+			line := measurement + ",host=" + influxEscape(host, ",= ")
+			if view := cacheViewName(md.View); view != "" {
+				line += ",view=" + influxEscape(view, ",= ")
+			}
+			fields := make([]string, 0, len(md.Info))
+			for _, key := range sortedKeys(md.Info) {
+				fields = append(fields, metricComponent(key)+"="+strconv.FormatFloat(md.Info[key], 'f', -1, 64))
+			}
+			if _, err := fmt.Fprintf(w, "%s %s %d\n", line, strings.Join(fields, ","), ts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// EncodeGraphite writes one plaintext line per counter, e.g.
+// bind.ns1.resolver_statistics.internal.query_retries 3 1598003941
+func EncodeGraphite(w io.Writer, host string, statsInfo *StatusInfo, now time.Time) error {
+	ts := dumpTime(statsInfo, now).Unix()
+	prefix := namespace + "." + metricComponent(host)
+	for _, section := range sortedSections(statsInfo) {
+		sectionPath := prefix + "." + strings.ToLower(metricComponent(section))
+		for _, md := range statsInfo.ModuleMap[section] {
+			view := metricComponent(cacheViewName(md.View))
+			if view == "" {
+				view = "global"
+			}
+			for _, key := range sortedKeys(md.Info) {
+				if _, err := fmt.Fprintf(w, "%s.%s.%s %s %d\n", sectionPath, view, metricComponent(key),
+					strconv.FormatFloat(md.Info[key], 'f', -1, 64), ts); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// dumpTime prefers the time of the dump over the time of the collection.
+func dumpTime(statsInfo *StatusInfo, now time.Time) time.Time {
+	if statsInfo.DumpTime > 0 {
+		return time.Unix(statsInfo.DumpTime, 0)
+	}
+	return now
+}
+
+func sortedSections(statsInfo *StatusInfo) []string {
+	sections := make([]string, 0, len(statsInfo.ModuleMap))
+	for section := range statsInfo.ModuleMap {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+	return sections
+}
+
+func sortedKeys(info map[string]float64) []string {
+	keys := make([]string, 0, len(info))
+	for key := range info {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// metricComponent turns a statistics name like "queries with RTT < 10ms"
+// into a name that is safe as an Influx field or Graphite path component,
+// e.g. queries_with_RTT_lt_10ms.
+func metricComponent(name string) string {
+	name = strings.NewReplacer("<", "lt", ">", "gt").Replace(name)
+	var b strings.Builder
+	underscore := false
+	for _, r := range name {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' {
+			if underscore && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+			underscore = false
+		} else {
+			underscore = true
+		}
+	}
+	return b.String()
+}
+
+func influxEscape(s, chars string) string {
+	for _, c := range chars {
+		s = strings.ReplaceAll(s, string(c), `\`+string(c))
+	}
+	return s
+}
+
+// writeTextfile writes everything gathered from g to path every interval,
+// until stop is closed, for the node_exporter textfile collector. The file is
+// replaced by a rename, so node_exporter never reads a partial file.
+func writeTextfile(path string, interval time.Duration, g prometheus.Gatherer, stop <-chan struct{}) {
+	runUntil(stop, interval, "Textfile write", func() error {
+		return prometheus.WriteToTextfile(path, g)
+	})
+}
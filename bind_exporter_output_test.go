@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+)
+
+func parsedScrape() (*StatusInfo, error) {
+	return ParserStats(str), nil
+}
+
+func Test_EncodeInflux(t *testing.T) {
+
+	var buf bytes.Buffer
+	if err := EncodeInflux(&buf, "ns 1", ParserStats(str), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	for _, want := range []string{
+		"bind_incoming_requests,host=ns\\ 1 NOTIFY=31342,QUERY=2263459024 1598003941000000000",
+		"bind_cache_db_rrsets,host=ns\\ 1,view=view_bj_mjq A=918,AAAA=962,CNAME=48,MX=1,NS=1,NXDOMAIN=73,PTR=1,RRSIG=1 1598003941000000000",
+	} {
+		if !containsLine(lines, want) {
+			t.Errorf("missing line %q", want)
+		}
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "bind_resolver_statistics,host=ns\\ 1,view=view_bj_ali ") &&
+			!strings.Contains(line, ",queries_with_RTT_lt_10ms=134115772,") {
+			t.Errorf("unexpected resolver line %q", line)
+		}
+	}
+}
+
+func Test_EncodeGraphite(t *testing.T) {
+
+	var buf bytes.Buffer
+	if err := EncodeGraphite(&buf, "ns1.example.com", ParserStats(str), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(buf.String(), "\n")
+	for _, want := range []string{
+		"bind.ns1_example_com.incoming_queries.global.AAAA 1029784471 1598003941",
+		"bind.ns1_example_com.resolver_statistics.view_bj_ali.queries_with_RTT_gt_1600ms 681 1598003941",
+		"bind.ns1_example_com.cache_db_rrsets.view_bj_ali.CNAME 64 1598003941",
+	} {
+		if !containsLine(lines, want) {
+			t.Errorf("missing line %q", want)
+		}
+	}
+}
+
+func containsLine(lines []string, want string) bool {
+	for _, line := range lines {
+		if line == want {
+			return true
+		}
+	}
+	return false
+}
+
+func expectedOutput(t *testing.T, encode statsEncoder) []byte {
+	var buf bytes.Buffer
+	if err := encode(&buf, "ns1", ParserStats(str), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func Test_StatsOutputUDP(t *testing.T) {
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	out, err := NewStatsOutput("udp://"+conn.LocalAddr().String(), "ns1", EncodeInflux, parsedScrape)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Write(); err != nil {
+		t.Fatal(err)
+	}
+	want := expectedOutput(t, EncodeInflux)
+	var got []byte
+	buf := make([]byte, 65536)
+	for len(got) < len(want) {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > maxDatagramSize || buf[n-1] != '\n' {
+			t.Errorf("datagram of %d bytes doesn't end on a line", n)
+		}
+		got = append(got, buf[:n]...)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("received\n%s\nwant\n%s", got, want)
+	}
+}
+
+func Test_StatsOutputTCP(t *testing.T) {
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+		data, _ := ioutil.ReadAll(conn)
+		received <- data
+	}()
+
+	out, err := NewStatsOutput("tcp://"+listener.Addr().String(), "ns1", EncodeGraphite, parsedScrape)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Write(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := <-received, expectedOutput(t, EncodeGraphite); !bytes.Equal(got, want) {
+		t.Errorf("received\n%s\nwant\n%s", got, want)
+	}
+}
+
+func Test_StatsOutputFile(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "bind.influx")
+	out, err := NewStatsOutput("file://"+path, "ns1", EncodeInflux, parsedScrape)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := out.Write(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := expectedOutput(t, EncodeInflux); !bytes.Equal(got, want) {
+		t.Errorf("file holds\n%s\nwant\n%s", got, want)
+	}
+	if _, err := NewStatsOutput("http://localhost", "ns1", EncodeInflux, parsedScrape); err == nil {
+		t.Error("expected an error for an unknown scheme")
+	}
+}
+
+// familyNames parses the text exposition format and returns the sorted
+// metric family names.
+func familyNames(t *testing.T, r io.Reader) []string {
+	var parser expfmt.TextParser
+	mfs, err := parser.TextToMetricFamilies(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(mfs))
+	for name := range mfs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func Test_WriteToTextfile(t *testing.T) {
+
+	dir := t.TempDir()
+	statsFile := filepath.Join(dir, "named.stats")
+	script := filepath.Join(dir, "stats.sh")
+	if err := ioutil.WriteFile(script, []byte("exit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(statsFile, []byte(str), 0644); err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewStatsCollector(StatsCollectorOpts{FilePath: statsFile, Script: script}))
+
+	textfile := filepath.Join(dir, "bind.prom")
+	stop := make(chan struct{})
+	close(stop)
+	writeTextfile(textfile, time.Hour, registry, stop)
+	f, err := os.Open(textfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	written := familyNames(t, f)
+
+	server := httptest.NewServer(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	served := familyNames(t, resp.Body)
+
+	if len(written) == 0 || !reflect.DeepEqual(written, served) {
+		t.Errorf("textfile families = %v, want %v", written, served)
+	}
+}
+
+func Test_WriteTextfileEvery(t *testing.T) {
+
+	dir := t.TempDir()
+	textfile := filepath.Join(dir, "bind.prom")
+	registry := prometheus.NewRegistry()
+	writes := prometheus.NewCounter(prometheus.CounterOpts{Name: "textfile_writes_total", Help: "Writes."})
+	registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: "textfile_write", Help: "Write."}, func() float64 {
+		writes.Inc()
+		return 1
+	}), writes)
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		writeTextfile(textfile, 10*time.Millisecond, registry, stop)
+		close(done)
+	}()
+	// the file keeps being replaced with the count of the writes so far
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			close(stop)
+			t.Fatal("textfile not rewritten")
+		}
+		f, err := os.Open(textfile)
+		if err != nil {
+			continue
+		}
+		var parser expfmt.TextParser
+		mfs, err := parser.TextToMetricFamilies(f)
+		f.Close()
+		if err != nil {
+			close(stop)
+			t.Fatal(err)
+		}
+		if mf := mfs["textfile_writes_total"]; mf != nil && mf.GetMetric()[0].GetCounter().GetValue() >= 3 {
+			break
+		}
+	}
+	close(stop)
+	<-done
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != "bind.prom" {
+		var names []string
+		for _, fi := range files {
+			names = append(names, fi.Name())
+		}
+		t.Errorf("files left in the textfile directory: %q", names)
+	}
+}
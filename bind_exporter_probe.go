@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+var (
+	probeLabels = []string{"name", "qtype", "transport"}
+
+	probeSuccess = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "probe", "success"),
+		"Was the probe answered with the expected rcode?",
+		probeLabels, nil,
+	)
+	probeDuration = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "probe", "duration_seconds"),
+		"Time the probe took, up to the timeout if unanswered.",
+		probeLabels, nil,
+	)
+	probeAnswerTTL = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "probe", "answer_ttl_seconds"),
+		"Lowest TTL of the answer records of the probe.",
+		probeLabels, nil,
+	)
+)
+
+// DNSProbe is a query sent to the local server.
+type DNSProbe struct {
+	Name string
+	Type uint16
+	// Transport is udp, tcp or tls.
+	Transport string
+	Rcode     int
+}
+
+// parseDNSProbe parses a probe given as name,type[,transport[,rcode]], the
+// transport defaulting to udp and the rcode to NOERROR.
+func parseDNSProbe(arg string) (DNSProbe, error) {
+	fields := strings.Split(arg, ",")
+	if len(fields) < 2 || len(fields) > 4 || fields[0] == "" {
+		return DNSProbe{}, fmt.Errorf("Probe %q is not in name,type[,transport[,rcode]] form", arg)
+	}
+	probe := DNSProbe{Name: dns.Fqdn(fields[0]), Transport: "udp", Rcode: dns.RcodeSuccess}
+	qtype, ok := dns.StringToType[strings.ToUpper(fields[1])]
+	if !ok {
+		return DNSProbe{}, fmt.Errorf("Probe %q has unknown type %s", arg, fields[1])
+	}
+	probe.Type = qtype
+	if len(fields) > 2 {
+		switch probe.Transport = strings.ToLower(fields[2]); probe.Transport {
+		case "udp", "tcp", "tls":
+		default:
+			return DNSProbe{}, fmt.Errorf("Probe %q has unknown transport %s, want udp, tcp or tls", arg, fields[2])
+		}
+	}
+	if len(fields) > 3 {
+		rcode, ok := dns.StringToRcode[strings.ToUpper(fields[3])]
+		if !ok {
+			return DNSProbe{}, fmt.Errorf("Probe %q has unknown rcode %s", arg, fields[3])
+		}
+		probe.Rcode = rcode
+	}
+	return probe, nil
+}
+
+// parseDNSProbes parses the probe flags. Probes are told apart by name, type
+// and transport only, so two probes differing in the expected rcode are
+// rejected rather than exported as duplicate series.
+func parseDNSProbes(args []string) ([]DNSProbe, error) {
+	probes := make([]DNSProbe, 0, len(args))
+	seen := map[DNSProbe]bool{}
+	for _, arg := range args {
+		probe, err := parseDNSProbe(arg)
+		if err != nil {
+			return nil, err
+		}
+		key := DNSProbe{Name: probe.Name, Type: probe.Type, Transport: probe.Transport}
+		if seen[key] {
+			return nil, fmt.Errorf("Probe %q repeats the name, type and transport of another probe", arg)
+		}
+		seen[key] = true
+		probes = append(probes, probe)
+	}
+	return probes, nil
+}
+
+// ProbeOpts configures the probe collector.
+type ProbeOpts struct {
+	Probes []DNSProbe
+	// Server is the address probes are sent to over udp and tcp, TLSServer
+	// the one for tls.
+	Server    string
+	TLSServer string
+	// TLSInsecure skips the verification of the certificate of TLSServer.
+	TLSInsecure bool
+	Timeout     time.Duration
+}
+
+type probeCollector struct {
+	opts ProbeOpts
+}
+
+// NewProbeCollector sends the probes to the local server on every scrape.
+func NewProbeCollector(opts ProbeOpts) prometheus.Collector {
+	return &probeCollector{opts: opts}
+}
+
+// Describe implements prometheus.Collector.
+func (c *probeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- probeSuccess
+	ch <- probeDuration
+	ch <- probeAnswerTTL
+}
+
+// Collect implements prometheus.Collector.
+func (c *probeCollector) Collect(ch chan<- prometheus.Metric) {
+	var wg sync.WaitGroup
+	for _, probe := range c.opts.Probes {
+		wg.Add(1)
+		go func(probe DNSProbe) {
+			defer wg.Done()
+			c.probe(ch, probe)
+		}(probe)
+	}
+	wg.Wait()
+}
+
+func (c *probeCollector) probe(ch chan<- prometheus.Metric, probe DNSProbe) {
+	labels := []string{probe.Name, qtypeName(probe.Type), probe.Transport}
+	client := &dns.Client{Net: probe.Transport, Timeout: c.opts.Timeout}
+	server := c.opts.Server
+	if probe.Transport == "tls" {
+		host, _, err := net.SplitHostPort(c.opts.TLSServer)
+		if err != nil {
+			host = c.opts.TLSServer
+		}
+		client.Net = "tcp-tls"
+		client.TLSConfig = &tls.Config{ServerName: host, InsecureSkipVerify: c.opts.TLSInsecure}
+		server = c.opts.TLSServer
+	}
+	m := &dns.Msg{}
+	m.SetQuestion(probe.Name, probe.Type)
+	start := time.Now()
+	r, _, err := client.Exchange(m, server)
+	ch <- prometheus.MustNewConstMetric(probeDuration, prometheus.GaugeValue, time.Since(start).Seconds(), labels...)
+	if err != nil {
+		log.Errorf("Probe %s %s over %s: %s", probe.Name, labels[1], probe.Transport, err)
+		ch <- prometheus.MustNewConstMetric(probeSuccess, prometheus.GaugeValue, 0, labels...)
+		return
+	}
+	if r.Rcode != probe.Rcode {
+		log.Warnf("Probe %s %s over %s: got %s, want %s", probe.Name, labels[1], probe.Transport,
+			dns.RcodeToString[r.Rcode], dns.RcodeToString[probe.Rcode])
+	}
+	ch <- prometheus.MustNewConstMetric(probeSuccess, prometheus.GaugeValue, boolToFloat(r.Rcode == probe.Rcode), labels...)
+	if len(r.Answer) > 0 {
+		ttl := r.Answer[0].Header().Ttl
+		for _, rr := range r.Answer[1:] {
+			if rr.Header().Ttl < ttl {
+				ttl = rr.Header().Ttl
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(probeAnswerTTL, prometheus.GaugeValue, float64(ttl), labels...)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// startDNSServer serves www.example.com. A with TTLs of 300 and 60, and
+// NXDOMAIN for any other name, on addr until the test ends.
+func startDNSServer(t *testing.T, network, addr string, config *tls.Config) string {
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := &dns.Msg{}
+		m.SetReply(r)
+		if r.Question[0].Name == "www.example.com." && r.Question[0].Qtype == dns.TypeA {
+			rr, _ := dns.NewRR("www.example.com. 300 IN A 192.0.2.80")
+			rr2, _ := dns.NewRR("www.example.com. 60 IN A 192.0.2.81")
+			m.Answer = []dns.RR{rr, rr2}
+		} else {
+			m.Rcode = dns.RcodeNameError
+		}
+		w.WriteMsg(m)
+	})
+	started := make(chan struct{})
+	server := &dns.Server{Net: network, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	switch network {
+	case "udp":
+		conn, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.PacketConn = conn
+	default:
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Skipf("Can't listen on %s: %s", addr, err)
+		}
+		if config != nil {
+			l = tls.NewListener(l, config)
+		}
+		server.Listener = l
+	}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+	if server.PacketConn != nil {
+		return server.PacketConn.LocalAddr().String()
+	}
+	return server.Listener.Addr().String()
+}
+
+func selfSignedConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+func Test_ParseDNSProbe(t *testing.T) {
+
+	probe, err := parseDNSProbe("example.com,aaaa,tls,nxdomain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if probe != (DNSProbe{Name: "example.com.", Type: dns.TypeAAAA, Transport: "tls", Rcode: dns.RcodeNameError}) {
+		t.Errorf("unexpected probe %+v", probe)
+	}
+	for _, arg := range []string{"example.com", "example.com,BOGUS", "example.com,A,quic", "example.com,A,udp,BOGUS"} {
+		if _, err := parseDNSProbe(arg); err == nil {
+			t.Errorf("no error for %q", arg)
+		}
+	}
+
+	probes, err := parseDNSProbes([]string{"example.com,A", "example.com,A,tcp", "example.com,AAAA"})
+	if err != nil || len(probes) != 3 {
+		t.Errorf("got %v, %v", probes, err)
+	}
+	if _, err := parseDNSProbes([]string{"example.com,A", "example.com,A,udp,nxdomain"}); err == nil {
+		t.Error("no error for probes differing only in the rcode")
+	}
+}
+
+func Test_ProbeCollector(t *testing.T) {
+
+	server := startDNSServer(t, "udp", "127.0.0.1:0", nil)
+	startDNSServer(t, "tcp", server, nil)
+	dot := startDNSServer(t, "tcp-tls", "127.0.0.1:0", selfSignedConfig(t))
+	probes := []DNSProbe{
+		{Name: "www.example.com.", Type: dns.TypeA, Transport: "udp", Rcode: dns.RcodeSuccess},
+		{Name: "nx.example.com.", Type: dns.TypeA, Transport: "udp", Rcode: dns.RcodeNameError},
+		{Name: "nx.example.com.", Type: dns.TypeAAAA, Transport: "udp", Rcode: dns.RcodeSuccess},
+		{Name: "www.example.com.", Type: dns.TypeA, Transport: "tcp", Rcode: dns.RcodeSuccess},
+		{Name: "www.example.com.", Type: dns.TypeA, Transport: "tls", Rcode: dns.RcodeSuccess},
+	}
+	collector := NewProbeCollector(ProbeOpts{
+		Probes:      probes,
+		Server:      server,
+		TLSServer:   dot,
+		TLSInsecure: true,
+		Timeout:     time.Second,
+	})
+	want := `# HELP bind_probe_answer_ttl_seconds Lowest TTL of the answer records of the probe.
+# TYPE bind_probe_answer_ttl_seconds gauge
+bind_probe_answer_ttl_seconds{name="www.example.com.",qtype="A",transport="tcp"} 60
+bind_probe_answer_ttl_seconds{name="www.example.com.",qtype="A",transport="tls"} 60
+bind_probe_answer_ttl_seconds{name="www.example.com.",qtype="A",transport="udp"} 60
+# HELP bind_probe_success Was the probe answered with the expected rcode?
+# TYPE bind_probe_success gauge
+bind_probe_success{name="nx.example.com.",qtype="A",transport="udp"} 1
+bind_probe_success{name="nx.example.com.",qtype="AAAA",transport="udp"} 0
+bind_probe_success{name="www.example.com.",qtype="A",transport="tcp"} 1
+bind_probe_success{name="www.example.com.",qtype="A",transport="tls"} 1
+bind_probe_success{name="www.example.com.",qtype="A",transport="udp"} 1
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want), "bind_probe_success", "bind_probe_answer_ttl_seconds"); err != nil {
+		t.Error(err)
+	}
+
+	// tcp against a server that isn't listening, and tls with verification
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := l.Addr().String()
+	l.Close()
+	collector = NewProbeCollector(ProbeOpts{
+		Probes: []DNSProbe{
+			{Name: "www.example.com.", Type: dns.TypeA, Transport: "tcp"},
+			{Name: "www.example.com.", Type: dns.TypeA, Transport: "tls"},
+		},
+		Server:    closed,
+		TLSServer: dot,
+		Timeout:   time.Second,
+	})
+	want = `# HELP bind_probe_success Was the probe answered with the expected rcode?
+# TYPE bind_probe_success gauge
+bind_probe_success{name="www.example.com.",qtype="A",transport="tcp"} 0
+bind_probe_success{name="www.example.com.",qtype="A",transport="tls"} 0
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want), "bind_probe_success", "bind_probe_answer_ttl_seconds"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(collector); n != 4 {
+		t.Errorf("got %d metrics, want success and duration of 2 probes", n)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/prometheus/common/log"
+)
+
+// labelsFlag collects repeated name=value flags into a label set.
+type labelsFlag map[string]string
+
+// String implements flag.Value.
+func (l labelsFlag) String() string {
+	pairs := make([]string, 0, len(l))
+	for name, value := range l {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set implements flag.Value.
+func (l labelsFlag) Set(v string) error {
+	idx := strings.Index(v, "=")
+	if idx < 1 {
+		return fmt.Errorf("Label %q is not in name=value form", v)
+	}
+	l[strings.TrimSpace(v[:idx])] = strings.TrimSpace(v[idx+1:])
+	return nil
+}
+
+// PushOpts defines how metrics are pushed to a Pushgateway.
+type PushOpts struct {
+	URL      string
+	Job      string
+	Grouping map[string]string
+	// Username and PasswordFile enable basic auth when Username is set.
+	Username     string
+	PasswordFile string
+	// Retries is the number of extra attempts after a failed push, waiting
+	// RetryBackoff before the first one and doubling it after each.
+	Retries      int
+	RetryBackoff time.Duration
+}
+
+type statsPusher struct {
+	pusher  *push.Pusher
+	url     string
+	retries int
+	backoff time.Duration
+}
+
+// NewStatsPusher returns a pusher that sends everything gathered from g to
+// the Pushgateway described by opts.
+func NewStatsPusher(opts PushOpts, g prometheus.Gatherer) (*statsPusher, error) {
+	pusher := push.New(opts.URL, opts.Job).Gatherer(g)
+	for name, value := range opts.Grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+	if opts.Username != "" {
+		password := ""
+		if opts.PasswordFile != "" {
+			content, err := ioutil.ReadFile(opts.PasswordFile)
+			if err != nil {
+				return nil, fmt.Errorf("Can't read push password file: %s", err)
+			}
+			password = strings.TrimSpace(string(content))
+		}
+		pusher = pusher.BasicAuth(opts.Username, password)
+	}
+	return &statsPusher{
+		pusher:  pusher,
+		url:     opts.URL,
+		retries: opts.Retries,
+		backoff: opts.RetryBackoff,
+	}, nil
+}
+
+// Push replaces the metrics of this job and grouping on the Pushgateway,
+// retrying with exponential backoff.
+func (p *statsPusher) Push() error {
+	backoff := p.backoff
+	for attempt := 0; ; attempt++ {
+		err := p.pusher.Push()
+		if err == nil {
+			return nil
+		}
+		if attempt >= p.retries {
+			return err
+		}
+		log.Warnf("Push to %s failed, retrying in %s: %s", p.url, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+type pushgatewayStub struct {
+	mu       sync.Mutex
+	failures int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (s *pushgatewayStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r)
+	s.bodies = append(s.bodies, body)
+	if s.failures > 0 {
+		s.failures--
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func Test_StatsPusherPush(t *testing.T) {
+
+	stub := &pushgatewayStub{failures: 2}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := ioutil.WriteFile(passwordFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "bind_up", Help: "test"})
+	gauge.Set(1)
+	registry.MustRegister(gauge)
+
+	pusher, err := NewStatsPusher(PushOpts{
+		URL:          server.URL,
+		Job:          "bind",
+		Grouping:     map[string]string{"instance": "ns1"},
+		Username:     "prom",
+		PasswordFile: passwordFile,
+		Retries:      2,
+		RetryBackoff: time.Millisecond,
+	}, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pusher.Push(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stub.requests) != 3 {
+		t.Fatalf("got %d requests, want 3", len(stub.requests))
+	}
+	r := stub.requests[2]
+	if r.Method != http.MethodPut {
+		t.Errorf("method = %s, want PUT", r.Method)
+	}
+	if r.URL.Path != "/metrics/job/bind/instance/ns1" {
+		t.Errorf("path = %s", r.URL.Path)
+	}
+	if user, password, ok := r.BasicAuth(); !ok || user != "prom" || password != "secret" {
+		t.Errorf("basic auth = %q %q %v", user, password, ok)
+	}
+	var mf dto.MetricFamily
+	dec := expfmt.NewDecoder(bytes.NewReader(stub.bodies[2]), expfmt.FmtProtoDelim)
+	if err := dec.Decode(&mf); err != nil {
+		t.Fatal(err)
+	}
+	if mf.GetName() != "bind_up" || mf.GetMetric()[0].GetGauge().GetValue() != 1 {
+		t.Errorf("pushed %s", mf.String())
+	}
+}
+
+func Test_StatsPusherGivesUp(t *testing.T) {
+
+	stub := &pushgatewayStub{failures: 10}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	pusher, err := NewStatsPusher(PushOpts{
+		URL:          server.URL,
+		Job:          "bind",
+		Retries:      1,
+		RetryBackoff: time.Millisecond,
+	}, prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pusher.Push(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(stub.requests) != 2 {
+		t.Errorf("got %d requests, want 2", len(stub.requests))
+	}
+}
+
+func Test_LabelsFlag(t *testing.T) {
+
+	l := labelsFlag{}
+	for _, v := range []string{"instance=ns1", "dc = bj"} {
+		if err := l.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if l.String() != "dc=bj,instance=ns1" {
+		t.Errorf("labels = %s", l)
+	}
+	if err := l.Set("=x"); err == nil {
+		t.Error("expected an error for an empty name")
+	}
+}
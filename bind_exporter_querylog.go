@@ -0,0 +1,257 @@
+package main
+
+import (
+	"container/heap"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// client @0x7f1c2c0ed758 192.0.2.1#53211 (www.example.com): view internal: query: www.example.com IN A +E(0)K (192.0.2.53)
+	queryLogReg = regexp.MustCompile(`client (?:@\S+ )?([0-9A-Fa-f.:]+)#\d+ \([^)]*\):(?: view ([^:]+):)? query: (\S+) (\S+) (\S+) (\S+)`)
+	// EDNS version in the flags, +E(0)
+	queryFlagsReg = regexp.MustCompile(`\(\d+\)|[^-+SETDCKV]`)
+
+	queryLogQueries = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "querylog", "queries_total"),
+		"Queries in the query log by view, type and flags.",
+		[]string{"view", "qtype", "flags"}, nil,
+	)
+	queryLogUnparsed = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "querylog", "unparsed_lines_total"),
+		"Lines of the query log that aren't queries.",
+		nil, nil,
+	)
+	queryLogTopClients = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "querylog", "top_client_subnet_queries"),
+		"Estimated queries since the exporter started of the client subnets sending the most queries.",
+		[]string{"subnet"}, nil,
+	)
+	queryLogTopSuffixes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "querylog", "top_qname_suffix_queries"),
+		"Estimated queries since the exporter started of the most queried name suffixes.",
+		[]string{"suffix"}, nil,
+	)
+)
+
+// QueryLogEntry is a query in the query log.
+type QueryLogEntry struct {
+	Client net.IP
+	View   string
+	Name   string
+	Type   string
+	Flags  string
+}
+
+// ParserQueryLog parses a line of the query log, with or without the time
+// and category printed before it. Queries of BIND without views are in view
+// _default.
+func ParserQueryLog(line string) (*QueryLogEntry, bool) {
+	m := queryLogReg.FindStringSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+	entry := &QueryLogEntry{
+		Client: net.ParseIP(m[1]),
+		View:   m[2],
+		Name:   m[3],
+		Type:   m[5],
+		Flags:  queryFlagsReg.ReplaceAllString(m[6], ""),
+	}
+	if entry.Client == nil {
+		return nil, false
+	}
+	if entry.View == "" {
+		entry.View = "_default"
+	}
+	if _, ok := dns.StringToType[entry.Type]; !ok {
+		entry.Type = "other"
+	}
+	return entry, true
+}
+
+// domainSuffix returns the last labels of name, lower cased.
+func domainSuffix(name string, labels int) string {
+	parts := strings.Split(strings.TrimSuffix(strings.ToLower(name), "."), ".")
+	if len(parts) > labels {
+		parts = parts[len(parts)-labels:]
+	}
+	if suffix := strings.Join(parts, "."); suffix != "" {
+		return suffix
+	}
+	return "."
+}
+
+// clientSubnet returns the subnet of ip with the prefix length of its family.
+func clientSubnet(ip net.IP, v4Prefix, v6Prefix int) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(v4Prefix, 32)).String() + "/" + strconv.Itoa(v4Prefix)
+	}
+	return ip.Mask(net.CIDRMask(v6Prefix, 128)).String() + "/" + strconv.Itoa(v6Prefix)
+}
+
+type spaceSavingItem struct {
+	key   string
+	count float64
+	index int
+}
+
+type spaceSavingHeap []*spaceSavingItem
+
+func (h spaceSavingHeap) Len() int           { return len(h) }
+func (h spaceSavingHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h spaceSavingHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *spaceSavingHeap) Push(x interface{}) {
+	item := x.(*spaceSavingItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+func (h *spaceSavingHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// spaceSaving counts the most frequent keys of a stream in at most capacity
+// counters. A new key takes over the smallest counter, so the counts of
+// frequent keys are overestimated by at most the smallest count.
+type spaceSaving struct {
+	capacity int
+	items    map[string]*spaceSavingItem
+	heap     spaceSavingHeap
+}
+
+func newSpaceSaving(capacity int) *spaceSaving {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &spaceSaving{capacity: capacity, items: map[string]*spaceSavingItem{}}
+}
+
+func (s *spaceSaving) add(key string) {
+	if item, ok := s.items[key]; ok {
+		item.count++
+		heap.Fix(&s.heap, item.index)
+		return
+	}
+	if len(s.heap) < s.capacity {
+		item := &spaceSavingItem{key: key, count: 1}
+		s.items[key] = item
+		heap.Push(&s.heap, item)
+		return
+	}
+	item := s.heap[0]
+	delete(s.items, item.key)
+	item.key = key
+	item.count++
+	s.items[key] = item
+	heap.Fix(&s.heap, 0)
+}
+
+// top returns the n largest counts.
+func (s *spaceSaving) top(n int) map[string]float64 {
+	items := append([]*spaceSavingItem{}, s.heap...)
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].count != items[j].count {
+			return items[i].count > items[j].count
+		}
+		return items[i].key < items[j].key
+	})
+	top := map[string]float64{}
+	for i := 0; i < n && i < len(items); i++ {
+		top[items[i].key] = items[i].count
+	}
+	return top
+}
+
+// QueryLogOpts configures the query log collector.
+type QueryLogOpts struct {
+	FilePath string
+	// TopN client subnets and name suffixes are exported, out of Capacity
+	// tracked ones.
+	TopN     int
+	Capacity int
+	// IPv4Prefix and IPv6Prefix group clients into subnets.
+	IPv4Prefix int
+	IPv6Prefix int
+	// SuffixLabels is the number of labels of the name suffixes.
+	SuffixLabels int
+}
+
+type queryLogKey struct {
+	view, qtype, flags string
+}
+
+type queryLogCollector struct {
+	opts QueryLogOpts
+	tail *tailer
+
+	mu       sync.Mutex
+	queries  map[queryLogKey]float64
+	unparsed float64
+	clients  *spaceSaving
+	suffixes *spaceSaving
+}
+
+// NewQueryLogCollector counts the queries in the query log. Poll has to be
+// called regularly to follow the file.
+func NewQueryLogCollector(opts QueryLogOpts) *queryLogCollector {
+	return &queryLogCollector{
+		opts:     opts,
+		tail:     newTailer(opts.FilePath),
+		queries:  map[queryLogKey]float64{},
+		clients:  newSpaceSaving(opts.Capacity),
+		suffixes: newSpaceSaving(opts.Capacity),
+	}
+}
+
+// Poll reads the lines appended to the query log since the last poll.
+func (c *queryLogCollector) Poll() error {
+	return c.tail.poll(func(line string) {
+		entry, ok := ParserQueryLog(line)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if !ok {
+			c.unparsed++
+			return
+		}
+		c.queries[queryLogKey{entry.View, entry.Type, entry.Flags}]++
+		c.clients.add(clientSubnet(entry.Client, c.opts.IPv4Prefix, c.opts.IPv6Prefix))
+		c.suffixes.add(domainSuffix(entry.Name, c.opts.SuffixLabels))
+	})
+}
+
+// Describe implements prometheus.Collector.
+func (c *queryLogCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- queryLogQueries
+	ch <- queryLogUnparsed
+	ch <- queryLogTopClients
+	ch <- queryLogTopSuffixes
+}
+
+// Collect implements prometheus.Collector.
+func (c *queryLogCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, v := range c.queries {
+		ch <- prometheus.MustNewConstMetric(queryLogQueries, prometheus.CounterValue, v, key.view, key.qtype, key.flags)
+	}
+	ch <- prometheus.MustNewConstMetric(queryLogUnparsed, prometheus.CounterValue, c.unparsed)
+	for subnet, v := range c.clients.top(c.opts.TopN) {
+		ch <- prometheus.MustNewConstMetric(queryLogTopClients, prometheus.GaugeValue, v, subnet)
+	}
+	for suffix, v := range c.suffixes.top(c.opts.TopN) {
+		ch <- prometheus.MustNewConstMetric(queryLogTopSuffixes, prometheus.GaugeValue, v, suffix)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_ParserQueryLog(t *testing.T) {
+
+	for _, test := range []struct {
+		line string
+		want QueryLogEntry
+	}{
+		{
+			"19-Oct-2026 10:00:00.123 queries: info: client @0x7f1c2c0ed758 192.0.2.1#53211 (www.example.com): view internal: query: www.example.com IN A +E(0)K (192.0.2.53)",
+			QueryLogEntry{View: "internal", Name: "www.example.com", Type: "A", Flags: "+EK"},
+		},
+		{
+			"client 2001:db8::1#4711 (example.org): query: example.org IN AAAA -EDC (2001:db8::53)",
+			QueryLogEntry{View: "_default", Name: "example.org", Type: "AAAA", Flags: "-EDC"},
+		},
+		{
+			"client @0x1 192.0.2.1#1 (x.example): query: x.example IN TYPE65534 + (192.0.2.53)",
+			QueryLogEntry{View: "_default", Name: "x.example", Type: "other", Flags: "+"},
+		},
+	} {
+		entry, ok := ParserQueryLog(test.line)
+		if !ok {
+			t.Errorf("can't parse %q", test.line)
+			continue
+		}
+		entry.Client = nil
+		if !reflect.DeepEqual(*entry, test.want) {
+			t.Errorf("got %+v, want %+v", *entry, test.want)
+		}
+	}
+	if _, ok := ParserQueryLog("general: info: zone example.com/IN: loaded serial 1"); ok {
+		t.Error("parsed a line that isn't a query")
+	}
+}
+
+func Test_SpaceSaving(t *testing.T) {
+
+	// keys more frequent than 1/10 of the stream are guaranteed to be kept
+	s := newSpaceSaving(10)
+	for i := 0; i < 100; i++ {
+		s.add("frequent")
+		if i%2 == 0 {
+			s.add("often")
+		}
+		s.add(fmt.Sprintf("rare%d", i))
+	}
+	if len(s.items) != 10 || len(s.heap) != 10 {
+		t.Fatalf("%d items tracked, want 10", len(s.items))
+	}
+	top := s.top(2)
+	if top["frequent"] < 100 || top["often"] < 50 || len(top) != 2 {
+		t.Errorf("unexpected top %v", top)
+	}
+}
+
+func Test_QueryLogCollector(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "queries.log")
+	if err := ioutil.WriteFile(path, []byte("client 192.0.2.9#1 (old.example): query: old.example IN A + (192.0.2.53)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	collector := NewQueryLogCollector(QueryLogOpts{
+		FilePath: path, TopN: 1, Capacity: 10, IPv4Prefix: 24, IPv6Prefix: 48, SuffixLabels: 2,
+	})
+	if err := collector.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fmt.Fprintln(f, "client @0x1 192.0.2.1#1 (www.example.com): view internal: query: www.example.com IN A +E(0) (192.0.2.53)")
+	fmt.Fprintln(f, "client @0x1 192.0.2.2#1 (mail.example.com): view internal: query: mail.example.com IN A +E(0) (192.0.2.53)")
+	fmt.Fprintln(f, "client @0x1 198.51.100.7#1 (example.org): view external: query: example.org IN MX - (192.0.2.53)")
+	fmt.Fprintln(f, "rate limit drop response to 198.51.100.0/24")
+	f.Close()
+	if err := collector.Poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP bind_querylog_queries_total Queries in the query log by view, type and flags.
+# TYPE bind_querylog_queries_total counter
+bind_querylog_queries_total{flags="+E",qtype="A",view="internal"} 2
+bind_querylog_queries_total{flags="-",qtype="MX",view="external"} 1
+# HELP bind_querylog_top_client_subnet_queries Estimated queries since the exporter started of the client subnets sending the most queries.
+# TYPE bind_querylog_top_client_subnet_queries gauge
+bind_querylog_top_client_subnet_queries{subnet="192.0.2.0/24"} 2
+# HELP bind_querylog_top_qname_suffix_queries Estimated queries since the exporter started of the most queried name suffixes.
+# TYPE bind_querylog_top_qname_suffix_queries gauge
+bind_querylog_top_qname_suffix_queries{suffix="example.com"} 2
+# HELP bind_querylog_unparsed_lines_total Lines of the query log that aren't queries.
+# TYPE bind_querylog_unparsed_lines_total counter
+bind_querylog_unparsed_lines_total 1
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+var (
+	recursingQueryReg = regexp.MustCompile(`^; client (\S+?)(?:: view (\S+))?: id \d+ '([^/']+)/([^/']+)/[^']+'.*?(?: requesttime (\d+))?$`)
+	fetchDomainsReg   = regexp.MustCompile(`^; Active fetch domains \[view: (\S+)\]`)
+	fetchDomainReg    = regexp.MustCompile(`^; (\S+): (\d+) active(?: \((\d+) spilled, \d+ allowed\))?`)
+
+	recursingQueries = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "recursing", "queries"),
+		"Number of client queries waiting for recursion.",
+		[]string{"qtype"}, nil,
+	)
+	recursingDomainQueries = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "recursing", "domain_queries"),
+		"Number of client queries waiting for recursion by domain, the domains beyond the top ones summed up as other.",
+		[]string{"domain"}, nil,
+	)
+	recursingFetches = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "recursing", "fetches"),
+		"Number of active fetches by domain, the domains beyond the top ones summed up as other.",
+		[]string{"view", "domain"}, nil,
+	)
+	recursingFetchesSpilled = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "recursing", "fetches_spilled"),
+		"Number of fetches dropped by fetches-per-zone by domain, the domains beyond the top ones summed up as other.",
+		[]string{"view", "domain"}, nil,
+	)
+	recursingOldest = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "recursing", "oldest_query_age_seconds"),
+		"Age of the oldest client query waiting for recursion.",
+		nil, nil,
+	)
+)
+
+// RecursingQuery is a client query waiting for recursion.
+type RecursingQuery struct {
+	Client      string
+	View        string
+	Name        string
+	Type        string
+	RequestTime int64
+}
+
+// RecursingFetches counts the active fetches of a domain.
+type RecursingFetches struct {
+	View    string
+	Domain  string
+	Active  float64
+	Spilled float64
+}
+
+// RecursingInfo is the parsed content of named.recursing.
+type RecursingInfo struct {
+	Queries []RecursingQuery
+	Fetches []RecursingFetches
+}
+
+// ParserRecursing parses the file written by rndc recursing.
+func ParserRecursing(content string) *RecursingInfo {
+	info := &RecursingInfo{}
+	view := ""
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if m := recursingQueryReg.FindStringSubmatch(line); m != nil {
+			q := RecursingQuery{Client: m[1], View: m[2], Name: m[3], Type: m[4]}
+			if q.View == "" {
+				q.View = "_default"
+			}
+			q.RequestTime, _ = strconv.ParseInt(m[5], 10, 64)
+			info.Queries = append(info.Queries, q)
+		} else if m := fetchDomainsReg.FindStringSubmatch(line); m != nil {
+			view = m[1]
+		} else if m := fetchDomainReg.FindStringSubmatch(line); m != nil && view != "" {
+			f := RecursingFetches{View: view, Domain: m[1]}
+			f.Active, _ = strconv.ParseFloat(m[2], 64)
+			f.Spilled, _ = strconv.ParseFloat(m[3], 64)
+			info.Fetches = append(info.Fetches, f)
+		}
+	}
+	return info
+}
+
+// baseDomain shortens a query name to its last two labels, which is what
+// operators usually group stuck queries by.
+func baseDomain(name string) string {
+	return domainSuffix(name, 2)
+}
+
+// topN keeps the n largest counts and sums up the rest as other, bounding
+// the number of series a domain label can create.
+func topN(counts map[string]float64, n int) map[string]float64 {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	top := map[string]float64{}
+	for i, key := range keys {
+		if i < n {
+			top[key] = counts[key]
+		} else {
+			top["other"] += counts[key]
+		}
+	}
+	return top
+}
+
+// foldOther sums up the counts of keys missing in keep as other.
+func foldOther(counts, keep map[string]float64) map[string]float64 {
+	folded := map[string]float64{}
+	for key, v := range counts {
+		if _, ok := keep[key]; !ok {
+			key = "other"
+		}
+		folded[key] += v
+	}
+	return folded
+}
+
+// RecursingOpts configures the rndc recursing collector.
+type RecursingOpts struct {
+	FilePath string
+	TopN     int
+}
+
+type recursingCollector struct {
+	run      rndcRunner
+	filePath string
+	topN     int
+	up       *prometheus.Desc
+
+	mu       sync.Mutex
+	last     *RecursingInfo
+	lastTime time.Time
+}
+
+// NewRecursingCollector triggers rndc recursing on every scrape and exports
+// the in-flight recursive queries found in the file it writes.
+func NewRecursingCollector(run rndcRunner, opts RecursingOpts) *recursingCollector {
+	return &recursingCollector{
+		run:      run,
+		filePath: opts.FilePath,
+		topN:     opts.TopN,
+		up:       newRndcUpDesc("recursing"),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *recursingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+	ch <- recursingQueries
+	ch <- recursingDomainQueries
+	ch <- recursingFetches
+	ch <- recursingFetchesSpilled
+	ch <- recursingOldest
+}
+
+func (c *recursingCollector) scrape() (*RecursingInfo, error) {
+	if _, err := c.run("recursing"); err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(c.filePath)
+	if err != nil {
+		return nil, fmt.Errorf("Can't read recursing file: %s", err)
+	}
+	return ParserRecursing(string(content)), nil
+}
+
+// Collect implements prometheus.Collector.
+func (c *recursingCollector) Collect(ch chan<- prometheus.Metric) {
+	info, err := c.scrape()
+	if err != nil {
+		log.Error(err)
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	c.last, c.lastTime = info, now
+	c.mu.Unlock()
+
+	byType := map[string]float64{}
+	byDomain := map[string]float64{}
+	oldest := 0.0
+	for _, q := range info.Queries {
+		byType[q.Type]++
+		byDomain[baseDomain(q.Name)]++
+		if q.RequestTime > 0 {
+			if age := now.Sub(time.Unix(q.RequestTime, 0)).Seconds(); age > oldest {
+				oldest = age
+			}
+		}
+	}
+	for qtype, v := range byType {
+		ch <- prometheus.MustNewConstMetric(recursingQueries, prometheus.GaugeValue, v, qtype)
+	}
+	for domain, v := range topN(byDomain, c.topN) {
+		ch <- prometheus.MustNewConstMetric(recursingDomainQueries, prometheus.GaugeValue, v, domain)
+	}
+	active := map[string]map[string]float64{}
+	spilled := map[string]map[string]float64{}
+	for _, f := range info.Fetches {
+		if active[f.View] == nil {
+			active[f.View], spilled[f.View] = map[string]float64{}, map[string]float64{}
+		}
+		active[f.View][f.Domain] += f.Active
+		spilled[f.View][f.Domain] += f.Spilled
+	}
+	for view, domains := range active {
+		top := topN(domains, c.topN)
+		for domain, v := range top {
+			ch <- prometheus.MustNewConstMetric(recursingFetches, prometheus.GaugeValue, v, view, domain)
+		}
+		for domain, v := range foldOther(spilled[view], top) {
+			ch <- prometheus.MustNewConstMetric(recursingFetchesSpilled, prometheus.GaugeValue, v, view, domain)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(recursingOldest, prometheus.GaugeValue, oldest)
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 1)
+}
+
+// ServeHTTP lists the queries of the last collection, oldest first.
+func (c *recursingCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	info, at := c.last, c.lastTime
+	c.mu.Unlock()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if info == nil {
+		fmt.Fprintln(w, "No rndc recursing collected yet.")
+		return
+	}
+	queries := append([]RecursingQuery{}, info.Queries...)
+	sort.SliceStable(queries, func(i, j int) bool { return queries[i].RequestTime < queries[j].RequestTime })
+	fmt.Fprintf(w, "%d recursing queries at %s\n\n", len(queries), at.Format(time.RFC3339))
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "AGE\tVIEW\tTYPE\tNAME\tCLIENT")
+	for _, q := range queries {
+		age := "-"
+		if q.RequestTime > 0 {
+			age = at.Sub(time.Unix(q.RequestTime, 0)).Truncate(time.Second).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", age, q.View, q.Type, q.Name, q.Client)
+	}
+	tw.Flush()
+	if len(info.Fetches) > 0 {
+		fmt.Fprintln(w)
+		tw = tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "VIEW\tDOMAIN\tACTIVE\tSPILLED")
+		for _, f := range info.Fetches {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", f.View, f.Domain, plainFloat(f.Active), plainFloat(f.Spilled))
+		}
+		tw.Flush()
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_ParserRecursing(t *testing.T) {
+
+	content, err := ioutil.ReadFile("testdata/named.recursing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := ParserRecursing(string(content))
+	if len(info.Queries) != 5 || len(info.Fetches) != 3 {
+		t.Fatalf("got %d queries and %d fetches", len(info.Queries), len(info.Fetches))
+	}
+	want := RecursingQuery{Client: "10.1.2.4#41533", View: "internal", Name: "mail.example.com", Type: "AAAA", RequestTime: 1598003930}
+	if info.Queries[1] != want {
+		t.Errorf("query = %+v, want %+v", info.Queries[1], want)
+	}
+	if info.Queries[2].View != "_default" {
+		t.Errorf("view = %q, want _default", info.Queries[2].View)
+	}
+	if f := info.Fetches[2]; f.View != "_default" || f.Domain != "example.org" || f.Active != 2 || f.Spilled != 1 {
+		t.Errorf("fetches = %+v", f)
+	}
+}
+
+func Test_TopN(t *testing.T) {
+
+	got := topN(map[string]float64{"a": 5, "b": 3, "c": 3, "d": 1}, 2)
+	if len(got) != 3 || got["a"] != 5 || got["b"] != 3 || got["other"] != 4 {
+		t.Errorf("got %v", got)
+	}
+}
+
+func Test_RecursingCollector(t *testing.T) {
+
+	triggered := 0
+	collector := NewRecursingCollector(func(args ...string) (string, error) {
+		triggered++
+		return "", nil
+	}, RecursingOpts{FilePath: "testdata/named.recursing", TopN: 1})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	want := `# HELP bind_recursing_domain_queries Number of client queries waiting for recursion by domain, the domains beyond the top ones summed up as other.
+# TYPE bind_recursing_domain_queries gauge
+bind_recursing_domain_queries{domain="example.com"} 2
+bind_recursing_domain_queries{domain="other"} 3
+# HELP bind_recursing_fetches_spilled Number of fetches dropped by fetches-per-zone by domain, the domains beyond the top ones summed up as other.
+# TYPE bind_recursing_fetches_spilled gauge
+bind_recursing_fetches_spilled{domain="example.com",view="internal"} 0
+bind_recursing_fetches_spilled{domain="example.org",view="_default"} 1
+bind_recursing_fetches_spilled{domain="other",view="_default"} 0
+# HELP bind_recursing_queries Number of client queries waiting for recursion.
+# TYPE bind_recursing_queries gauge
+bind_recursing_queries{qtype="A"} 2
+bind_recursing_queries{qtype="AAAA"} 1
+bind_recursing_queries{qtype="SRV"} 1
+bind_recursing_queries{qtype="TXT"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want),
+		"bind_recursing_domain_queries", "bind_recursing_fetches_spilled", "bind_recursing_queries"); err != nil {
+		t.Error(err)
+	}
+	if triggered != 1 {
+		t.Errorf("rndc recursing ran %d times", triggered)
+	}
+
+	rec := httptest.NewRecorder()
+	collector.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/recursing", nil))
+	lines := strings.Split(rec.Body.String(), "\n")
+	if !strings.HasPrefix(lines[0], "5 recursing queries at ") || !strings.Contains(lines[3], "www.example.com") {
+		t.Errorf("unexpected debug page:\n%s", rec.Body.String())
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/log"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// RemoteWriteOpts defines how metrics are sent to a remote_write endpoint.
+type RemoteWriteOpts struct {
+	URL string
+	// Username and PasswordFile enable basic auth when Username is set.
+	Username     string
+	PasswordFile string
+	Timeout      time.Duration
+	// ExternalLabels are added to every series that doesn't carry them yet.
+	ExternalLabels map[string]string
+	// QueueSize bounds the number of requests kept while the endpoint is
+	// unreachable. When it is full the oldest request is dropped.
+	QueueSize int
+	// QueueDir, if set, keeps queued requests on disk so that they survive
+	// a restart of the exporter.
+	QueueDir string
+}
+
+// queuedRequest is a snappy compressed WriteRequest waiting to be sent.
+type queuedRequest struct {
+	data []byte
+	path string
+}
+
+type remoteWriter struct {
+	opts     RemoteWriteOpts
+	password string
+	client   *http.Client
+	gatherer prometheus.Gatherer
+	queue    []queuedRequest
+}
+
+// NewRemoteWriter returns a writer sending everything gathered from g to the
+// remote_write endpoint described by opts.
+func NewRemoteWriter(opts RemoteWriteOpts, g prometheus.Gatherer) (*remoteWriter, error) {
+	w := &remoteWriter{
+		opts:     opts,
+		client:   &http.Client{Timeout: opts.Timeout},
+		gatherer: g,
+	}
+	if opts.Username != "" && opts.PasswordFile != "" {
+		content, err := ioutil.ReadFile(opts.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("Can't read remote write password file: %s", err)
+		}
+		w.password = strings.TrimSpace(string(content))
+	}
+	if opts.QueueDir != "" {
+		if err := os.MkdirAll(opts.QueueDir, 0700); err != nil {
+			return nil, fmt.Errorf("Can't create remote write queue directory: %s", err)
+		}
+		paths, err := filepath.Glob(filepath.Join(opts.QueueDir, "*.snappy"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("Can't read queued remote write request: %s", err)
+			}
+			w.queue = append(w.queue, queuedRequest{data: data, path: path})
+		}
+		w.trimQueue()
+	}
+	return w, nil
+}
+
+// Send gathers the current metrics, queues them and sends the whole queue in
+// order. Requests the endpoint failed to accept because of a temporary
+// problem stay queued for the next call.
+func (w *remoteWriter) Send() error {
+	mfs, err := w.gatherer.Gather()
+	if err != nil {
+		log.Error(err)
+	}
+	series := toTimeSeries(mfs, w.opts.ExternalLabels, time.Now())
+	if len(series) > 0 {
+		if err := w.enqueue(snappy.Encode(nil, encodeWriteRequest(series))); err != nil {
+			return err
+		}
+	}
+	for len(w.queue) > 0 {
+		retry, err := w.post(w.queue[0].data)
+		if err != nil && retry {
+			return fmt.Errorf("%s (%d requests queued)", err, len(w.queue))
+		}
+		if err != nil {
+			log.Errorf("Dropping remote write request: %s", err)
+		}
+		w.dequeue()
+	}
+	return nil
+}
+
+func (w *remoteWriter) enqueue(data []byte) error {
+	req := queuedRequest{data: data}
+	if w.opts.QueueDir != "" {
+		req.path = filepath.Join(w.opts.QueueDir, fmt.Sprintf("%020d.snappy", time.Now().UnixNano()))
+		tmp := req.path + ".tmp"
+		if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, req.path); err != nil {
+			return err
+		}
+	}
+	w.queue = append(w.queue, req)
+	w.trimQueue()
+	return nil
+}
+
+func (w *remoteWriter) dequeue() {
+	if w.queue[0].path != "" {
+		if err := os.Remove(w.queue[0].path); err != nil {
+			log.Error(err)
+		}
+	}
+	w.queue = w.queue[1:]
+}
+
+// trimQueue drops the oldest requests beyond QueueSize.
+func (w *remoteWriter) trimQueue() {
+	for w.opts.QueueSize > 0 && len(w.queue) > w.opts.QueueSize {
+		log.Warn("Remote write queue is full, dropping the oldest request")
+		w.dequeue()
+	}
+}
+
+// post sends one request and reports whether a failure is worth retrying.
+func (w *remoteWriter) post(data []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.opts.URL, bytes.NewReader(data))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", EXPORTER)
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	if w.opts.Username != "" {
+		req.SetBasicAuth(w.opts.Username, w.password)
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return false, nil
+	}
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("unexpected status code %d while writing to %s: %s", resp.StatusCode, w.opts.URL, body)
+	return resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests, err
+}
+
+type promLabel struct {
+	name, value string
+}
+
+type promSample struct {
+	value     float64
+	timestamp int64
+}
+
+type timeSeries struct {
+	labels  []promLabel
+	samples []promSample
+}
+
+// toTimeSeries flattens metric families the same way Prometheus stores them,
+// splitting histograms and summaries into their _bucket, _sum and _count
+// series.
+func toTimeSeries(mfs []*dto.MetricFamily, external map[string]string, now time.Time) []timeSeries {
+	var series []timeSeries
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			ts := now.UnixNano() / int64(time.Millisecond)
+			if m.TimestampMs != nil {
+				ts = m.GetTimestampMs()
+			}
+			add := func(name string, value float64, extra ...promLabel) {
+				labels := []promLabel{{"__name__", name}}
+				for _, l := range m.GetLabel() {
+					labels = append(labels, promLabel{l.GetName(), l.GetValue()})
+				}
+				labels = append(labels, extra...)
+				for name, value := range external {
+					if !hasLabel(labels, name) {
+						labels = append(labels, promLabel{name, value})
+					}
+				}
+				sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+				series = append(series, timeSeries{labels: labels, samples: []promSample{{value, ts}}})
+			}
+			name := mf.GetName()
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, m.GetCounter().GetValue())
+			case dto.MetricType_GAUGE:
+				add(name, m.GetGauge().GetValue())
+			case dto.MetricType_UNTYPED:
+				add(name, m.GetUntyped().GetValue())
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					add(name+"_bucket", float64(b.GetCumulativeCount()), promLabel{"le", formatFloat(b.GetUpperBound())})
+				}
+				add(name+"_bucket", float64(h.GetSampleCount()), promLabel{"le", "+Inf"})
+				add(name+"_sum", h.GetSampleSum())
+				add(name+"_count", float64(h.GetSampleCount()))
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add(name, q.GetValue(), promLabel{"quantile", formatFloat(q.GetQuantile())})
+				}
+				add(name+"_sum", s.GetSampleSum())
+				add(name+"_count", float64(s.GetSampleCount()))
+			}
+		}
+	}
+	return series
+}
+
+func hasLabel(labels []promLabel, name string) bool {
+	for _, l := range labels {
+		if l.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// encodeWriteRequest encodes series as a prometheus.WriteRequest protobuf
+// message.
+func encodeWriteRequest(series []timeSeries) []byte {
+	var buf []byte
+	for _, s := range series {
+		var tsBuf []byte
+		for _, l := range s.labels {
+			var lBuf []byte
+			lBuf = protowire.AppendTag(lBuf, 1, protowire.BytesType)
+			lBuf = protowire.AppendString(lBuf, l.name)
+			lBuf = protowire.AppendTag(lBuf, 2, protowire.BytesType)
+			lBuf = protowire.AppendString(lBuf, l.value)
+			tsBuf = protowire.AppendTag(tsBuf, 1, protowire.BytesType)
+			tsBuf = protowire.AppendBytes(tsBuf, lBuf)
+		}
+		for _, sample := range s.samples {
+			var sBuf []byte
+			sBuf = protowire.AppendTag(sBuf, 1, protowire.Fixed64Type)
+			sBuf = protowire.AppendFixed64(sBuf, math.Float64bits(sample.value))
+			sBuf = protowire.AppendTag(sBuf, 2, protowire.VarintType)
+			sBuf = protowire.AppendVarint(sBuf, uint64(sample.timestamp))
+			tsBuf = protowire.AppendTag(tsBuf, 2, protowire.BytesType)
+			tsBuf = protowire.AppendBytes(tsBuf, sBuf)
+		}
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, tsBuf)
+	}
+	return buf
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type remoteWriteStub struct {
+	mu       sync.Mutex
+	status   int
+	requests [][]timeSeries
+}
+
+func (s *remoteWriteStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status != 0 {
+		http.Error(w, "unavailable", s.status)
+		return
+	}
+	compressed, _ := ioutil.ReadAll(r.Body)
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil || r.Header.Get("Content-Encoding") != "snappy" {
+		http.Error(w, "bad encoding", http.StatusBadRequest)
+		return
+	}
+	series, err := decodeWriteRequest(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.requests = append(s.requests, series)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *remoteWriteStub) setStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// decodeWriteRequest is the inverse of encodeWriteRequest.
+func decodeWriteRequest(data []byte) ([]timeSeries, error) {
+	var series []timeSeries
+	err := consumeMessage(data, func(num protowire.Number, v []byte) error {
+		var ts timeSeries
+		err := consumeMessage(v, func(num protowire.Number, v []byte) error {
+			if num == 1 {
+				var l promLabel
+				err := consumeMessage(v, func(num protowire.Number, v []byte) error {
+					if num == 1 {
+						l.name = string(v)
+					} else {
+						l.value = string(v)
+					}
+					return nil
+				})
+				ts.labels = append(ts.labels, l)
+				return err
+			}
+			var sample promSample
+			for len(v) > 0 {
+				num, typ, n := protowire.ConsumeTag(v)
+				v = v[n:]
+				if num == 1 && typ == protowire.Fixed64Type {
+					bits, n := protowire.ConsumeFixed64(v)
+					sample.value = math.Float64frombits(bits)
+					v = v[n:]
+				} else {
+					ts, n := protowire.ConsumeVarint(v)
+					sample.timestamp = int64(ts)
+					v = v[n:]
+				}
+			}
+			ts.samples = append(ts.samples, sample)
+			return nil
+		})
+		series = append(series, ts)
+		return err
+	})
+	return series, err
+}
+
+func consumeMessage(data []byte, fn func(protowire.Number, []byte) error) error {
+	for len(data) > 0 {
+		num, _, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		v, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if err := fn(num, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func seriesName(ts timeSeries) string {
+	for _, l := range ts.labels {
+		if l.name == "__name__" {
+			return l.value
+		}
+	}
+	return ""
+}
+
+func newRemoteWriteRegistry() (*prometheus.Registry, prometheus.Gauge) {
+	registry := prometheus.NewRegistry()
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "bind_up", Help: "test"})
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "bind_rtt",
+		Help:    "test",
+		Buckets: []float64{10, 100},
+	})
+	histogram.Observe(5)
+	registry.MustRegister(gauge, histogram)
+	return registry, gauge
+}
+
+func Test_RemoteWriterSend(t *testing.T) {
+
+	stub := &remoteWriteStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	registry, gauge := newRemoteWriteRegistry()
+	gauge.Set(1)
+	writer, err := NewRemoteWriter(RemoteWriteOpts{
+		URL:            server.URL,
+		ExternalLabels: map[string]string{"instance": "ns1"},
+		QueueSize:      10,
+	}, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Send(); err != nil {
+		t.Fatal(err)
+	}
+	if len(stub.requests) != 1 {
+		t.Fatalf("got %d requests, want 1", len(stub.requests))
+	}
+	names := map[string]float64{}
+	for _, ts := range stub.requests[0] {
+		for i := 1; i < len(ts.labels); i++ {
+			if ts.labels[i-1].name >= ts.labels[i].name {
+				t.Errorf("labels not sorted: %v", ts.labels)
+			}
+		}
+		if !hasLabel(ts.labels, "instance") {
+			t.Errorf("missing external label: %v", ts.labels)
+		}
+		names[seriesName(ts)] += ts.samples[0].value
+	}
+	want := map[string]float64{
+		"bind_up":         1,
+		"bind_rtt_bucket": 3,
+		"bind_rtt_sum":    5,
+		"bind_rtt_count":  1,
+	}
+	for name, value := range want {
+		if names[name] != value {
+			t.Errorf("%s = %v, want %v", name, names[name], value)
+		}
+	}
+}
+
+func Test_RemoteWriterQueue(t *testing.T) {
+
+	stub := &remoteWriteStub{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	registry, gauge := newRemoteWriteRegistry()
+	dir := t.TempDir()
+	writer, err := NewRemoteWriter(RemoteWriteOpts{
+		URL:       server.URL,
+		QueueSize: 2,
+		QueueDir:  dir,
+	}, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		gauge.Set(float64(i))
+		if err := writer.Send(); err == nil {
+			t.Fatal("expected an error while the endpoint is down")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A restarted writer picks up the requests left on disk.
+	writer, err = NewRemoteWriter(RemoteWriteOpts{
+		URL:       server.URL,
+		QueueSize: 2,
+		QueueDir:  dir,
+	}, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(writer.queue) != 2 {
+		t.Fatalf("queue holds %d requests, want 2", len(writer.queue))
+	}
+
+	stub.setStatus(0)
+	gauge.Set(4)
+	if err := writer.Send(); err != nil {
+		t.Fatal(err)
+	}
+	var got []float64
+	for _, series := range stub.requests {
+		for _, ts := range series {
+			if seriesName(ts) == "bind_up" {
+				got = append(got, ts.samples[0].value)
+			}
+		}
+	}
+	if len(got) != 2 || got[0] != 3 || got[1] != 4 {
+		t.Errorf("sent bind_up values %v, want [3 4]", got)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("%d files left in the queue directory", len(files))
+	}
+}
+
+func Test_RemoteWriterDropsRejected(t *testing.T) {
+
+	stub := &remoteWriteStub{status: http.StatusBadRequest}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	registry, _ := newRemoteWriteRegistry()
+	writer, err := NewRemoteWriter(RemoteWriteOpts{URL: server.URL, QueueSize: 2}, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Send(); err != nil {
+		t.Fatal(err)
+	}
+	if len(writer.queue) != 0 {
+		t.Errorf("queue holds %d requests, want 0", len(writer.queue))
+	}
+}
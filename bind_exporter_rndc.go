@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newRndcUpDesc describes bind_rndc_up for one rndc command. The command is
+// a constant label, so every collector running rndc can register its own.
+func newRndcUpDesc(command string) *prometheus.Desc {
+	return prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "rndc", "up"),
+		"Was the last rndc command successful?",
+		nil, prometheus.Labels{"command": command},
+	)
+}
+
+// rndcRunner runs rndc with the given arguments and returns its output.
+// Collectors take it as a function so tests can replay captured output.
+type rndcRunner func(args ...string) (string, error)
+
+// RndcOpts configures how rndc is run.
+type RndcOpts struct {
+	Path    string
+	Timeout time.Duration
+	// Server, Port and KeyFile are passed as -s, -p and -k when set,
+	// otherwise rndc falls back to rndc.conf or rndc.key.
+	Server  string
+	Port    string
+	KeyFile string
+}
+
+// NewRndcRunner returns a runner executing the rndc binary.
+func NewRndcRunner(opts RndcOpts) rndcRunner {
+	var global []string
+	if opts.Server != "" {
+		global = append(global, "-s", opts.Server)
+	}
+	if opts.Port != "" {
+		global = append(global, "-p", opts.Port)
+	}
+	if opts.KeyFile != "" {
+		global = append(global, "-k", opts.KeyFile)
+	}
+	return func(args ...string) (string, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+		defer cancel()
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, opts.Path, append(global[:len(global):len(global)], args...)...)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			msg := strings.TrimSpace(stderr.String())
+			if msg == "" {
+				msg = strings.TrimSpace(stdout.String())
+			}
+			return "", fmt.Errorf("rndc %s failed: %s: %s", strings.Join(args, " "), err, msg)
+		}
+		return stdout.String(), nil
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+// rndcStatusGauges maps the "key: value" lines of rndc status holding a
+// single number to their metrics.
+var rndcStatusGauges = map[string]*prometheus.Desc{
+	"CPUs found": prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "cpus"),
+		"Number of CPUs found by BIND.",
+		nil, nil,
+	),
+	"worker threads": prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "worker_threads"),
+		"Number of worker threads.",
+		nil, nil,
+	),
+	"UDP listeners per interface": prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "udp_listeners_per_interface"),
+		"Number of UDP listeners per interface.",
+		nil, nil,
+	),
+	"debug level": prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "debug_level"),
+		"Current debug level.",
+		nil, nil,
+	),
+	"xfers running": prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "xfers_running"),
+		"Number of zone transfers running.",
+		nil, nil,
+	),
+	"xfers deferred": prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "xfers_deferred"),
+		"Number of zone transfers deferred.",
+		nil, nil,
+	),
+	"soa queries in progress": prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "soa_queries_in_progress"),
+		"Number of SOA queries in progress.",
+		nil, nil,
+	),
+	"TCP high-water": prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "tcp_clients_high_water"),
+		"Highest number of concurrent TCP clients since start.",
+		nil, nil,
+	),
+}
+
+var (
+	serverInfo = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "server_info"),
+		"Version of the running BIND.",
+		[]string{"version"}, nil,
+	)
+	configTime = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "config_time_seconds"),
+		"Time of the last configuration load since unix epoch in seconds.",
+		nil, nil,
+	)
+	zonesCount = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "zones"),
+		"Number of zones, including automatic empty zones.",
+		nil, nil,
+	)
+	automaticZonesCount = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "automatic_zones"),
+		"Number of automatic empty zones.",
+		nil, nil,
+	)
+	queryLogging = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "query_logging_enabled"),
+		"Is query logging on?",
+		nil, nil,
+	)
+	recursiveClients = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "recursive_clients"),
+		"Number of recursive clients.",
+		nil, nil,
+	)
+	recursiveClientsLimit = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "recursive_clients_limit"),
+		"Soft and hard limits of recursive clients.",
+		[]string{"type"}, nil,
+	)
+	tcpClients = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "tcp_clients"),
+		"Number of TCP clients.",
+		nil, nil,
+	)
+	tcpClientsLimit = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "tcp_clients_limit"),
+		"Limit of TCP clients.",
+		nil, nil,
+	)
+	serverRunning = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "server_running"),
+		"Does rndc status report the server as up and running?",
+		nil, nil,
+	)
+)
+
+// RndcStatus is the parsed output of rndc status. Values holds the single
+// number lines keyed like rndcStatusGauges, lines missing in the running
+// BIND version are left out.
+type RndcStatus struct {
+	Version         string
+	ConfigTime      time.Time
+	Zones           float64
+	AutomaticZones  float64
+	QueryLogging    bool
+	Running         bool
+	Values          map[string]float64
+	RecursiveLimits map[string]float64
+	// Counts and limits are -1 if not reported.
+	RecursiveClients float64
+	TCPClients       float64
+	TCPClientsLimit  float64
+}
+
+// ParserRndcStatus parses the output of rndc status.
+func ParserRndcStatus(out string) *RndcStatus {
+	status := &RndcStatus{
+		Zones:            -1,
+		AutomaticZones:   -1,
+		RecursiveClients: -1,
+		TCPClients:       -1,
+		TCPClientsLimit:  -1,
+		Values:           map[string]float64{},
+		RecursiveLimits:  map[string]float64{},
+	}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "query logging is "):
+			status.QueryLogging = strings.TrimPrefix(line, "query logging is ") == "ON"
+			continue
+		case line == "server is up and running":
+			status.Running = true
+			continue
+		}
+		i := strings.Index(line, ": ")
+		if i < 0 {
+			continue
+		}
+		key, value := line[:i], strings.TrimSpace(line[i+2:])
+		switch key {
+		case "version":
+			// BIND 9.16.23-RH (Extended Support Version) <id:fde3b1f>
+			fields := strings.Fields(value)
+			if len(fields) > 1 && fields[0] == "BIND" {
+				status.Version = fields[1]
+			} else if len(fields) > 0 {
+				status.Version = fields[0]
+			}
+		case "last configured":
+			if t, err := time.Parse(time.RFC1123, value); err == nil {
+				status.ConfigTime = t
+			}
+		case "number of zones":
+			// 105 (97 automatic)
+			fields := strings.Fields(strings.NewReplacer("(", " ", ")", " ").Replace(value))
+			if len(fields) > 0 {
+				status.Zones = parseRndcNumber(fields[0])
+			}
+			if len(fields) > 1 {
+				status.AutomaticZones = parseRndcNumber(fields[1])
+			}
+		case "recursive clients":
+			// current/soft/hard
+			parts := strings.Split(value, "/")
+			status.RecursiveClients = parseRndcNumber(parts[0])
+			if len(parts) == 3 {
+				status.RecursiveLimits["soft"] = parseRndcNumber(parts[1])
+				status.RecursiveLimits["hard"] = parseRndcNumber(parts[2])
+			}
+		case "tcp clients":
+			// current/limit
+			parts := strings.Split(value, "/")
+			status.TCPClients = parseRndcNumber(parts[0])
+			if len(parts) == 2 {
+				status.TCPClientsLimit = parseRndcNumber(parts[1])
+			}
+		default:
+			if _, ok := rndcStatusGauges[key]; ok {
+				if v := parseRndcNumber(value); v >= 0 {
+					status.Values[key] = v
+				}
+			}
+		}
+	}
+	return status
+}
+
+// parseRndcNumber returns -1 for anything not a number.
+func parseRndcNumber(s string) float64 {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return -1
+	}
+	return v
+}
+
+type rndcStatusCollector struct {
+	run rndcRunner
+	up  *prometheus.Desc
+}
+
+// NewRndcStatusCollector exports the output of rndc status.
+func NewRndcStatusCollector(run rndcRunner) prometheus.Collector {
+	return &rndcStatusCollector{run: run, up: newRndcUpDesc("status")}
+}
+
+// Describe implements prometheus.Collector.
+func (c *rndcStatusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+	for _, desc := range rndcStatusGauges {
+		ch <- desc
+	}
+	for _, desc := range []*prometheus.Desc{
+		serverInfo, configTime, zonesCount, automaticZonesCount, queryLogging,
+		recursiveClients, recursiveClientsLimit, tcpClients, tcpClientsLimit, serverRunning,
+	} {
+		ch <- desc
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *rndcStatusCollector) Collect(ch chan<- prometheus.Metric) {
+	out, err := c.run("status")
+	if err != nil {
+		log.Error(err)
+		ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, 0)
+		return
+	}
+	status := ParserRndcStatus(out)
+	gauge := func(desc *prometheus.Desc, v float64, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, labels...)
+	}
+	if status.Version != "" {
+		gauge(serverInfo, 1, status.Version)
+	}
+	if !status.ConfigTime.IsZero() {
+		gauge(configTime, float64(status.ConfigTime.Unix()))
+	}
+	for key, v := range status.Values {
+		gauge(rndcStatusGauges[key], v)
+	}
+	if status.Zones >= 0 {
+		gauge(zonesCount, status.Zones)
+	}
+	if status.AutomaticZones >= 0 {
+		gauge(automaticZonesCount, status.AutomaticZones)
+	}
+	if status.RecursiveClients >= 0 {
+		gauge(recursiveClients, status.RecursiveClients)
+	}
+	for limit, v := range status.RecursiveLimits {
+		gauge(recursiveClientsLimit, v, limit)
+	}
+	if status.TCPClients >= 0 {
+		gauge(tcpClients, status.TCPClients)
+	}
+	if status.TCPClientsLimit >= 0 {
+		gauge(tcpClientsLimit, status.TCPClientsLimit)
+	}
+	gauge(queryLogging, boolToFloat(status.QueryLogging))
+	gauge(serverRunning, boolToFloat(status.Running))
+	gauge(c.up, 1)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
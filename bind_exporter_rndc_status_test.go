@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fixtureRunner replays captured rndc output from testdata.
+func fixtureRunner(t *testing.T, files map[string]string) rndcRunner {
+	return func(args ...string) (string, error) {
+		file, ok := files[strings.Join(args, " ")]
+		if !ok {
+			return "", errors.New("rndc: connect failed: 127.0.0.1#953: connection refused")
+		}
+		content, err := ioutil.ReadFile(filepath.Join("testdata", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content), nil
+	}
+}
+
+func Test_ParserRndcStatus(t *testing.T) {
+
+	content, err := ioutil.ReadFile("testdata/rndc.status.9.11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := ParserRndcStatus(string(content))
+	if status.Version != "9.11.4-P2-RedHat-9.11.4-26.P2.el7_9.13" {
+		t.Errorf("version = %q", status.Version)
+	}
+	if want := time.Date(2020, 8, 25, 7, 2, 11, 0, time.UTC); !status.ConfigTime.Equal(want) {
+		t.Errorf("config time = %s, want %s", status.ConfigTime, want)
+	}
+	if status.Zones != 105 || status.AutomaticZones != 97 || status.RecursiveClients != 12 ||
+		status.RecursiveLimits["soft"] != 900 || status.RecursiveLimits["hard"] != 1000 ||
+		status.TCPClients != 3 || status.TCPClientsLimit != 150 || status.QueryLogging || !status.Running {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if _, ok := status.Values["TCP high-water"]; ok {
+		t.Error("TCP high-water is not reported by 9.11")
+	}
+}
+
+func Test_RndcStatusCollector(t *testing.T) {
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewRndcStatusCollector(fixtureRunner(t, map[string]string{"status": "rndc.status.9.18"})))
+	want := `# HELP bind_recursive_clients Number of recursive clients.
+# TYPE bind_recursive_clients gauge
+bind_recursive_clients 0
+# HELP bind_recursive_clients_limit Soft and hard limits of recursive clients.
+# TYPE bind_recursive_clients_limit gauge
+bind_recursive_clients_limit{type="hard"} 1000
+bind_recursive_clients_limit{type="soft"} 900
+# HELP bind_rndc_up Was the last rndc command successful?
+# TYPE bind_rndc_up gauge
+bind_rndc_up{command="status"} 1
+# HELP bind_server_info Version of the running BIND.
+# TYPE bind_server_info gauge
+bind_server_info{version="9.18.28-0ubuntu0.22.04.1-Ubuntu"} 1
+# HELP bind_query_logging_enabled Is query logging on?
+# TYPE bind_query_logging_enabled gauge
+bind_query_logging_enabled 1
+# HELP bind_tcp_clients_high_water Highest number of concurrent TCP clients since start.
+# TYPE bind_tcp_clients_high_water gauge
+bind_tcp_clients_high_water 4
+# HELP bind_zones Number of zones, including automatic empty zones.
+# TYPE bind_zones gauge
+bind_zones 102
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want),
+		"bind_recursive_clients", "bind_recursive_clients_limit", "bind_rndc_up", "bind_server_info",
+		"bind_query_logging_enabled", "bind_tcp_clients_high_water", "bind_zones"); err != nil {
+		t.Error(err)
+	}
+
+	registry = prometheus.NewRegistry()
+	registry.MustRegister(NewRndcStatusCollector(fixtureRunner(t, nil)))
+	want = `# HELP bind_rndc_up Was the last rndc command successful?
+# TYPE bind_rndc_up gauge
+bind_rndc_up{command="status"} 0
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+func Test_RndcRunner(t *testing.T) {
+
+	rndc := filepath.Join(t.TempDir(), "rndc")
+	script := "#!/bin/sh\nif [ \"$1\" = status ]; then echo 'server is up and running'; else echo 'unknown command' >&2; exit 1; fi\n"
+	if err := ioutil.WriteFile(rndc, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	run := NewRndcRunner(RndcOpts{Path: rndc, Timeout: 5 * time.Second})
+	if out, err := run("status"); err != nil || out != "server is up and running\n" {
+		t.Errorf("got %q, %v", out, err)
+	}
+	if _, err := run("bogus"); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Errorf("got %v, want the stderr of rndc", err)
+	}
+
+	if err := ioutil.WriteFile(rndc, []byte("#!/bin/sh\necho \"$@\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	run = NewRndcRunner(RndcOpts{Path: rndc, Timeout: 5 * time.Second, Server: "127.0.0.1", Port: "9953", KeyFile: "/etc/rndc.key"})
+	if out, err := run("zonestatus", "example.com"); err != nil || out != "-s 127.0.0.1 -p 9953 -k /etc/rndc.key zonestatus example.com\n" {
+		t.Errorf("got %q, %v", out, err)
+	}
+}
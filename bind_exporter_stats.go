@@ -2,12 +2,16 @@ package main
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"math"
+	"os"
 	"os/exec"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/log"
@@ -29,6 +33,16 @@ var (
 		"Start time of the BIND process since unix epoch in seconds.",
 		nil, nil,
 	)
+	stale = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, STATS, "stale"),
+		"Are the exported statistics those of the last successful dump, kept because the current one failed?",
+		nil, nil,
+	)
+	dumpTimestamp = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, STATS, "dump_timestamp_seconds"),
+		"Time the statistics dump was written by BIND since unix epoch in seconds.",
+		nil, nil,
+	)
 	nameServerStatistics = prometheus.NewDesc(
 		prometheus.BuildFQName(namespace, "", "name_server_stats_total"),
 		"Name Server Statistics Counters.",
@@ -307,27 +321,84 @@ var (
 	}
 )
 
+// StatsCollectorOpts defines the behavior of a stats collector.
+type StatsCollectorOpts struct {
+	// FilePath is the statistics-file BIND writes its dump to.
+	FilePath string
+	// Script is the shell script that triggers the dump, usually `rndc stats`.
+	Script string
+	// DumpTimestamp attaches the time found in the dump header to every
+	// sample, so that rate() follows the BIND-side dump interval.
+	DumpTimestamp bool
+	// MemStatsFile is the memstatistics-file, read along with the statistics
+	// file if set. named writes it on its own, it isn't triggered by Script.
+	MemStatsFile string
+	// Derived adds ratio gauges computed from the increase of counters
+	// between two consecutive dumps.
+	Derived bool
+	// StaleGrace is how long the last successful dump keeps being exported
+	// after the dump failed, so a short failure doesn't break rate() or
+	// fire absent() alerts.
+	StaleGrace time.Duration
+	// MinInterval is the time after a dump during which scrapes reuse it
+	// instead of running Script again.
+	MinInterval time.Duration
+}
+
 type statsCollector struct {
-	filePath string
-	rndc     string
+	filePath      string
+	rndc          string
+	memStatsFile  string
+	dumpTimestamp bool
+	derived       bool
+	staleGrace    time.Duration
+	minInterval   time.Duration
+
+	mu       sync.Mutex
+	base     *StatusInfo
+	prev     *StatusInfo
+	last     *StatusInfo
+	lastTime time.Time
+
+	dumpMu     sync.Mutex
+	inflight   *dumpCall
+	recent     *StatusInfo
+	recentTime time.Time
+}
+
+// dumpCall is a run of the trigger script and parse that concurrent scrapes
+// wait for.
+type dumpCall struct {
+	done      chan struct{}
+	statsInfo *StatusInfo
+	err       error
 }
 
 // newServerCollector implements collectorConstructor.
-func NewStatsCollector(fd, rndc string) prometheus.Collector {
+func NewStatsCollector(opts StatsCollectorOpts) *statsCollector {
 	return &statsCollector{
-		filePath: fd,
-		rndc:     rndc,
+		filePath:      opts.FilePath,
+		rndc:          opts.Script,
+		memStatsFile:  opts.MemStatsFile,
+		dumpTimestamp: opts.DumpTimestamp,
+		derived:       opts.Derived,
+		staleGrace:    opts.StaleGrace,
+		minInterval:   opts.MinInterval,
 	}
 }
 
 // Describe implements prometheus.Collector.
 func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- up
+	if c.staleGrace > 0 {
+		ch <- stale
+	}
 	ch <- bootTime
+	ch <- dumpTimestamp
 	ch <- nameServerStatistics
 	ch <- incomingQueries
 	ch <- incomingRequests
-	ch <- incomingRequests
+	ch <- outgoingQueries
 	ch <- socketIO
 	ch <- zoneMetricStats
 	ch <- cacheRRsetsStats
@@ -339,50 +410,190 @@ func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
 	for _, desc := range cacheMetricStatsFile {
 		ch <- desc
 	}
+	if c.memStatsFile != "" {
+		ch <- memoryContextBytes
+		ch <- memoryTotalBytes
+		ch <- memoryContexts
+		ch <- memoryDumpTimestamp
+	}
+	if c.derived {
+		for _, ratio := range derivedRatios {
+			ch <- ratio.desc
+		}
+	}
 }
 
 // Collect implements prometheus.Collector.
 func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
-	var outInfo bytes.Buffer
-	rcmd := exec.Command("/bin/sh", c.rndc)
-	rcmd.Stdout = &outInfo
-	err := rcmd.Run()
-	log.Info("sh info:", outInfo.String())
+	statsInfo, err := c.scrape()
 	if err != nil {
 		log.Error(err)
 		ch <- prometheus.MustNewConstMetric(
 			up, prometheus.GaugeValue, 0,
 		)
+		last := c.lastGood()
+		if c.staleGrace > 0 {
+			ch <- prometheus.MustNewConstMetric(stale, prometheus.GaugeValue, boolToFloat(last != nil))
+		}
+		if last != nil {
+			c.collectStats(ch, last)
+			if last.Memory != nil {
+				collectMemStats(ch, last.Memory)
+			}
+		}
 		return
 	}
-	contentBs, err := ioutil.ReadFile(c.filePath)
-	if err != nil || len(contentBs) < 10 {
-		log.Error(err)
-		ch <- prometheus.MustNewConstMetric(
-			up, prometheus.GaugeValue, 0,
-		)
-		return
+	if c.staleGrace > 0 {
+		c.mu.Lock()
+		c.last, c.lastTime = statsInfo, time.Now()
+		c.mu.Unlock()
+		ch <- prometheus.MustNewConstMetric(stale, prometheus.GaugeValue, 0)
+	}
+	c.collectStats(ch, statsInfo)
+	if statsInfo.Memory != nil {
+		collectMemStats(ch, statsInfo.Memory)
+	}
+	if c.derived {
+		c.collectDerived(ch, statsInfo)
 	}
-	statsInfo := ParserStats(string(contentBs))
-	// log.Println(statsInfo)
 	ch <- prometheus.MustNewConstMetric(
-		bootTime, prometheus.GaugeValue, float64(statsInfo.BootTime),
+		up, prometheus.GaugeValue, 1,
 	)
+}
+
+// lastGood returns the last successful dump while it is within the stale
+// grace period. Derived ratios aren't kept, there is no increase to compute
+// them from.
+func (c *statsCollector) lastGood() *StatusInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last == nil || time.Since(c.lastTime) > c.staleGrace {
+		return nil
+	}
+	return c.last
+}
+
+// scrape returns the parsed statistics dump. Concurrent scrapes share one
+// dump, as two runs of the trigger script would truncate and write the same
+// file, and a dump younger than the minimum interval is reused.
+func (c *statsCollector) scrape() (*StatusInfo, error) {
+	c.dumpMu.Lock()
+	if c.recent != nil && time.Since(c.recentTime) < c.minInterval {
+		statsInfo := c.recent
+		c.dumpMu.Unlock()
+		return statsInfo, nil
+	}
+	if call := c.inflight; call != nil {
+		c.dumpMu.Unlock()
+		<-call.done
+		return call.statsInfo, call.err
+	}
+	// the error stays if dump panics, so the waiting scrapes fail too
+	call := &dumpCall{done: make(chan struct{}), err: fmt.Errorf("Statistics dump of %s aborted", c.filePath)}
+	c.inflight = call
+	c.dumpMu.Unlock()
+	defer func() {
+		c.dumpMu.Lock()
+		c.inflight = nil
+		if call.err == nil {
+			c.recent, c.recentTime = call.statsInfo, time.Now()
+		}
+		c.dumpMu.Unlock()
+		close(call.done)
+	}()
+
+	call.statsInfo, call.err = c.dump()
+	return call.statsInfo, call.err
+}
+
+// dump runs the trigger script and parses the statistics file it produced.
+func (c *statsCollector) dump() (*StatusInfo, error) {
+	var outInfo bytes.Buffer
+	rcmd := exec.Command("/bin/sh", c.rndc)
+	rcmd.Stdout = &outInfo
+	err := rcmd.Run()
+	log.Info("sh info:", outInfo.String())
+	if err != nil {
+		return nil, err
+	}
+	content, _, err := readDump("Statistics file", c.filePath)
+	if err != nil {
+		return nil, err
+	}
+	statsInfo := ParserStats(content)
+	if c.memStatsFile != "" {
+		// a missing memstatistics-file doesn't fail the scrape, named
+		// only writes it on shutdown
+		content, modTime, err := readDump("Memstatistics file", c.memStatsFile)
+		if err != nil {
+			log.Warnf("Can't read memstatistics-file: %s", err)
+		} else {
+			statsInfo.Memory = ParserMemStats(content)
+			statsInfo.Memory.DumpTime = modTime.Unix()
+		}
+	}
+	return statsInfo, nil
+}
+
+// readDump reads a file written by named, which is empty while named is
+// still writing it. kind names the file in errors.
+func readDump(kind, path string) (string, time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	contentBs, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if len(contentBs) < 10 {
+		return "", time.Time{}, fmt.Errorf("%s %s is empty", kind, path)
+	}
+	return string(contentBs), fi.ModTime(), nil
+}
+
+// emitter returns a function sending metrics of statsInfo to ch, stamped
+// with the dump time if the collector is configured with DumpTimestamp.
+func (c *statsCollector) emitter(ch chan<- prometheus.Metric, statsInfo *StatusInfo) func(prometheus.Metric) {
+	return func(m prometheus.Metric) {
+		if c.dumpTimestamp && statsInfo.DumpTime > 0 {
+			m = prometheus.NewMetricWithTimestamp(time.Unix(statsInfo.DumpTime, 0), m)
+		}
+		ch <- m
+	}
+}
+
+// collectStats turns a parsed statistics dump into metrics. When the
+// collector is configured with DumpTimestamp, every sample carries the time
+// of the dump instead of the scrape time.
+func (c *statsCollector) collectStats(ch chan<- prometheus.Metric, statsInfo *StatusInfo) {
+	emit := c.emitter(ch, statsInfo)
+	emit(prometheus.MustNewConstMetric(
+		dumpTimestamp, prometheus.GaugeValue, float64(statsInfo.DumpTime),
+	))
+	emit(prometheus.MustNewConstMetric(
+		bootTime, prometheus.GaugeValue, float64(statsInfo.BootTime),
+	))
 	if mds, ok := statsInfo.ModuleMap["Incoming Requests"]; ok {
 		for _, md := range mds {
 			for key, value := range md.Info {
-				ch <- prometheus.MustNewConstMetric(
+				emit(prometheus.MustNewConstMetric(
 					incomingRequests, prometheus.GaugeValue, value, key,
-				)
+				))
 			}
 		}
 	}
 	if mds, ok := statsInfo.ModuleMap["Incoming Queries"]; ok {
 		for _, md := range mds {
 			for key, value := range md.Info {
-				ch <- prometheus.MustNewConstMetric(
+				emit(prometheus.MustNewConstMetric(
 					incomingQueries, prometheus.CounterValue, value, key,
-				)
+				))
 			}
 		}
 	}
@@ -391,9 +602,9 @@ func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
 		for _, md := range mds {
 			for key, value := range md.Info {
 				if tk, kok := nameServerMap[key]; kok {
-					ch <- prometheus.MustNewConstMetric(
+					emit(prometheus.MustNewConstMetric(
 						nameServerStatistics, prometheus.CounterValue, value, tk,
-					)
+					))
 				}
 			}
 		}
@@ -402,9 +613,9 @@ func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
 	if mds, ok := statsInfo.ModuleMap["Outgoing Queries"]; ok {
 		for _, md := range mds {
 			for key, value := range md.Info {
-				ch <- prometheus.MustNewConstMetric(
+				emit(prometheus.MustNewConstMetric(
 					outgoingQueries, prometheus.CounterValue, value, md.View, key,
-				)
+				))
 			}
 		}
 	}
@@ -416,18 +627,18 @@ func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
 				if rk, kok := resolverStatisticsMap[key]; kok {
 					if rk != "QryRTTnn" {
 						if pd, pok := resolverMetricStatsFile[rk]; pok {
-							ch <- prometheus.MustNewConstMetric(
+							emit(prometheus.MustNewConstMetric(
 								pd, prometheus.CounterValue, value, md.View,
-							)
+							))
 						}
 					}
 				}
 			}
 			if pd, pok := resolverMetricStatsFile["QryRTTnn"]; pok {
 				if buckets, count, err := getHistogram(md); err == nil {
-					ch <- prometheus.MustNewConstHistogram(
+					emit(prometheus.MustNewConstHistogram(
 						pd, count, math.NaN(), buckets, md.View,
-					)
+					))
 				}
 			}
 		}
@@ -438,9 +649,9 @@ func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
 		for _, md := range mds {
 			for key, value := range md.Info {
 				if tk, kok := socketMap[key]; kok {
-					ch <- prometheus.MustNewConstMetric(
+					emit(prometheus.MustNewConstMetric(
 						socketIO, prometheus.CounterValue, value, tk,
-					)
+					))
 				}
 			}
 		}
@@ -450,9 +661,9 @@ func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
 		for _, md := range mds {
 			for key, value := range md.Info {
 				if tk, kok := zoneMap[key]; kok {
-					ch <- prometheus.MustNewConstMetric(
+					emit(prometheus.MustNewConstMetric(
 						zoneMetricStats, prometheus.CounterValue, value, tk,
-					)
+					))
 				}
 			}
 		}
@@ -461,17 +672,9 @@ func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
 	if mds, ok := statsInfo.ModuleMap["Cache DB RRsets"]; ok {
 		for _, md := range mds {
 			for key, value := range md.Info {
-				/*if len(md.View) < 1 {
-					continue
-				}*/
-				idx := strings.Index(md.View, "(")
-				if idx < 0 {
-					idx = len(md.View)
-				}
-				view := strings.Trim(md.View[0:idx], " ")
-				ch <- prometheus.MustNewConstMetric(
-					cacheRRsetsStats, prometheus.CounterValue, value, view, key,
-				)
+				emit(prometheus.MustNewConstMetric(
+					cacheRRsetsStats, prometheus.CounterValue, value, cacheViewName(md.View), key,
+				))
 			}
 		}
 	}
@@ -481,17 +684,24 @@ func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
 			for key, value := range md.Info {
 				if rk, kok := cacheStatsMap[key]; kok {
 					if pd, pok := cacheMetricStatsFile[rk]; pok {
-						ch <- prometheus.MustNewConstMetric(
+						emit(prometheus.MustNewConstMetric(
 							pd, prometheus.GaugeValue, value, md.View,
-						)
+						))
 					}
 				}
 			}
 		}
 	}
-	ch <- prometheus.MustNewConstMetric(
-		up, prometheus.GaugeValue, 1,
-	)
+}
+
+// cacheViewName strips the cache name from views like
+// "view_bj_ali (Cache: view_bj_ali)".
+func cacheViewName(view string) string {
+	idx := strings.Index(view, "(")
+	if idx < 0 {
+		idx = len(view)
+	}
+	return strings.Trim(view[0:idx], " ")
 }
 
 type RttHistog struct {
@@ -531,7 +741,9 @@ type Module struct {
 // easygen: json
 type StatusInfo struct {
 	BootTime  int64               `json:"boot_time"`
+	DumpTime  int64               `json:"dump_time"`
 	ModuleMap map[string][]Module `json:"module_map"`
+	Memory    *MemStats           `json:"memory,omitempty"`
 }
 
 func ParserStats(content string) *StatusInfo {
@@ -553,6 +765,10 @@ func ParserStats(content string) *StatusInfo {
 			// 提取时间戳
 			ts = numReg.FindAllString(line, -1)
 		} else if strings.HasPrefix(line, "---") {
+			// the last module, usually a zone, has no following header
+			if len(im.Info) > 0 {
+				stats.ModuleMap[sub] = append(stats.ModuleMap[sub], *im)
+			}
 			break
 		} else if strings.HasPrefix(line, "++") {
 			// sub = ""
@@ -601,6 +817,7 @@ func ParserStats(content string) *StatusInfo {
 	if len(ts) > 0 {
 		ti, _ := strconv.ParseInt(ts[0], 10, 64)
 		stats.BootTime = ti
+		stats.DumpTime = ti
 	}
 
 	/*fmt.Println(stats, ts[0])
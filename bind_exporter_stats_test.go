@@ -2,8 +2,15 @@ package main
 
 import (
 	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 var (
@@ -519,3 +526,246 @@ func Test_ParserStatsForRRsets(t *testing.T) {
 		}
 	}
 }
+
+func Test_ParserStatsLastModule(t *testing.T) {
+
+	dump := `+++ Statistics Dump +++ (1598003941)
+++ Per Zone Query Statistics ++
+[example.com]
+                  10 QrySuccess
+[example.org]
+                   5 QrySuccess
+                   2 QryNXDOMAIN
+--- Statistics Dump --- (1598003941)
+`
+	mds := ParserStats(dump).ModuleMap["Per Zone Query Statistics"]
+	if len(mds) != 2 {
+		t.Fatalf("modules = %d, want 2", len(mds))
+	}
+	last := mds[1]
+	if last.View != "example.org" || last.Info["QrySuccess"] != 5 || last.Info["QryNXDOMAIN"] != 2 {
+		t.Fatalf("last module = %+v", last)
+	}
+}
+
+func Test_StatsCollectorDescribe(t *testing.T) {
+
+	ch := make(chan *prometheus.Desc)
+	go func() {
+		NewStatsCollector(StatsCollectorOpts{}).Describe(ch)
+		close(ch)
+	}()
+	seen := map[string]bool{}
+	for desc := range ch {
+		if seen[desc.String()] {
+			t.Errorf("described twice: %s", desc)
+		}
+		seen[desc.String()] = true
+	}
+	if !seen[outgoingQueries.String()] {
+		t.Error("outgoing queries not described")
+	}
+}
+
+func Test_CollectStatsDumpTimestamp(t *testing.T) {
+
+	statsInfo := ParserStats(str)
+	if statsInfo.DumpTime != 1598003941 {
+		t.Fatalf("dump time = %d, want 1598003941", statsInfo.DumpTime)
+	}
+	for _, withTimestamp := range []bool{false, true} {
+		c := &statsCollector{dumpTimestamp: withTimestamp}
+		ch := make(chan prometheus.Metric)
+		go func() {
+			c.collectStats(ch, statsInfo)
+			close(ch)
+		}()
+		for m := range ch {
+			var pb dto.Metric
+			if err := m.Write(&pb); err != nil {
+				t.Fatal(err)
+			}
+			if withTimestamp && pb.GetTimestampMs() != 1598003941000 {
+				t.Errorf("%s: timestamp = %d, want 1598003941000", m.Desc(), pb.GetTimestampMs())
+			}
+			if !withTimestamp && pb.TimestampMs != nil {
+				t.Errorf("%s: unexpected timestamp %d", m.Desc(), pb.GetTimestampMs())
+			}
+		}
+	}
+}
+
+// parsedStatsCollector collects a fixed dump instead of running the trigger.
+type parsedStatsCollector struct {
+	statsCollector
+	statsInfo *StatusInfo
+}
+
+func (c *parsedStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.collectStats(ch, c.statsInfo)
+}
+
+func Test_CollectStaleGrace(t *testing.T) {
+
+	dir := t.TempDir()
+	statsFile := filepath.Join(dir, "named.stats")
+	broken := filepath.Join(dir, "broken")
+	script := filepath.Join(dir, "stats.sh")
+	if err := ioutil.WriteFile(script, []byte("if [ -e "+broken+" ]; then exit 1; fi\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(statsFile, []byte(str), 0644); err != nil {
+		t.Fatal(err)
+	}
+	collector := NewStatsCollector(StatsCollectorOpts{
+		FilePath:   statsFile,
+		Script:     script,
+		StaleGrace: time.Hour,
+	})
+	collect := func() (up, stale float64, series int) {
+		registry := prometheus.NewPedanticRegistry()
+		registry.MustRegister(collector)
+		mfs, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, mf := range mfs {
+			switch mf.GetName() {
+			case "bind_up":
+				up = mf.GetMetric()[0].GetGauge().GetValue()
+			case "bind_stats_stale":
+				stale = mf.GetMetric()[0].GetGauge().GetValue()
+			default:
+				series += len(mf.GetMetric())
+			}
+		}
+		return
+	}
+
+	up, stale, fresh := collect()
+	if up != 1 || stale != 0 || fresh == 0 {
+		t.Fatalf("up %v, stale %v, %d series", up, stale, fresh)
+	}
+	if err := ioutil.WriteFile(broken, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if up, stale, series := collect(); up != 0 || stale != 1 || series != fresh {
+		t.Errorf("within grace: up %v, stale %v, %d series, want %d", up, stale, series, fresh)
+	}
+	collector.lastTime = time.Now().Add(-2 * time.Hour)
+	if up, stale, series := collect(); up != 0 || stale != 0 || series != 0 {
+		t.Errorf("after grace: up %v, stale %v, %d series", up, stale, series)
+	}
+	if err := os.Remove(broken); err != nil {
+		t.Fatal(err)
+	}
+	if up, stale, series := collect(); up != 1 || stale != 0 || series != fresh {
+		t.Errorf("recovered: up %v, stale %v, %d series", up, stale, series)
+	}
+}
+
+// slowStatsScript writes a trigger script that counts its runs and takes a
+// while, and returns a function reading the count.
+func slowStatsScript(t *testing.T, dir string) (string, func() int) {
+	runs := filepath.Join(dir, "runs")
+	script := filepath.Join(dir, "stats.sh")
+	if err := ioutil.WriteFile(script, []byte("echo run >> "+runs+"\nsleep 0.5\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return script, func() int {
+		content, err := ioutil.ReadFile(runs)
+		if os.IsNotExist(err) {
+			return 0
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Count(string(content), "run")
+	}
+}
+
+func Test_ScrapeCoalescing(t *testing.T) {
+
+	dir := t.TempDir()
+	statsFile := filepath.Join(dir, "named.stats")
+	if err := ioutil.WriteFile(statsFile, []byte(str), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script, countRuns := slowStatsScript(t, dir)
+	collector := NewStatsCollector(StatsCollectorOpts{FilePath: statsFile, Script: script})
+
+	const scrapes = 5
+	results := make(chan *StatusInfo, scrapes)
+	scrape := func() {
+		statsInfo, err := collector.scrape()
+		if err != nil {
+			t.Error(err)
+		}
+		results <- statsInfo
+	}
+	go scrape()
+	// the others start while the first one runs the script
+	for deadline := time.Now().Add(5 * time.Second); countRuns() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("script not started")
+		}
+	}
+	for i := 1; i < scrapes; i++ {
+		go scrape()
+	}
+	first := <-results
+	for i := 1; i < scrapes; i++ {
+		if statsInfo := <-results; statsInfo != first {
+			t.Error("concurrent scrapes got different dumps")
+		}
+	}
+	if n := countRuns(); n != 1 {
+		t.Errorf("script ran %d times for %d concurrent scrapes, want 1", n, scrapes)
+	}
+	if statsInfo, _ := collector.scrape(); statsInfo == first || countRuns() != 2 {
+		t.Error("script not run again after the concurrent scrapes finished")
+	}
+}
+
+func Test_ScrapeMinInterval(t *testing.T) {
+
+	dir := t.TempDir()
+	statsFile := filepath.Join(dir, "named.stats")
+	if err := ioutil.WriteFile(statsFile, []byte(str), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script, countRuns := slowStatsScript(t, dir)
+	collector := NewStatsCollector(StatsCollectorOpts{
+		FilePath:    statsFile,
+		Script:      script,
+		Derived:     true,
+		MinInterval: time.Hour,
+	})
+	first, err := collector.scrape()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statsInfo, _ := collector.scrape(); statsInfo != first || countRuns() != 1 {
+		t.Error("dump within the minimum interval not reused")
+	}
+
+	collector.minInterval = 0
+	if statsInfo, _ := collector.scrape(); statsInfo == first || countRuns() != 2 {
+		t.Error("script not run again after the minimum interval")
+	}
+
+	// a reused dump keeps the ratios against the dump before it
+	cur := ParserStats(str)
+	bumpCounter(cur, "Name Server Statistics", "", "responses sent", 1000)
+	bumpCounter(cur, "Name Server Statistics", "", "queries resulted in SERVFAIL", 10)
+	collector.prev = first
+	count := func() int {
+		ch := make(chan prometheus.Metric, 100)
+		collector.collectDerived(ch, cur)
+		close(ch)
+		return len(ch)
+	}
+	if n, again := count(), count(); n == 0 || again != n {
+		t.Errorf("got %d ratios, then %d for the reused dump", n, again)
+	}
+}
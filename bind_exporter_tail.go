@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// tailer follows a log file written by named across rotations. It starts at
+// the end of the file, so a restart of the exporter doesn't count lines
+// again, and at the start of files appearing later, such as the new file
+// after a rotation.
+type tailer struct {
+	path string
+
+	f       *os.File
+	fi      os.FileInfo
+	rd      *bufio.Reader
+	partial string
+	started bool
+}
+
+func newTailer(path string) *tailer {
+	return &tailer{path: path}
+}
+
+// poll passes the lines appended since the last poll to handle. A rotated
+// file is read to its end before switching to the new one. A missing file
+// isn't an error, named creates it on the first line.
+func (t *tailer) poll(handle func(line string)) error {
+	fi, err := os.Stat(t.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if t.f != nil {
+		if err := t.read(handle); err != nil {
+			return err
+		}
+		offset, err := t.f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		switch {
+		case fi == nil || !os.SameFile(fi, t.fi):
+			// renamed or removed, the old file is drained
+			t.close()
+		case fi.Size() < offset:
+			// truncated by copytruncate, noticed while the file is shorter
+			// than what was read
+			t.close()
+		default:
+			return nil
+		}
+	}
+	if fi == nil {
+		t.started = true
+		return nil
+	}
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	if fi, err = f.Stat(); err != nil {
+		f.Close()
+		return err
+	}
+	if !t.started {
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			return err
+		}
+		t.started = true
+	}
+	t.f, t.fi, t.rd = f, fi, bufio.NewReader(f)
+	return t.read(handle)
+}
+
+// read passes the complete lines up to the end of the file to handle,
+// keeping a partly written last line for the next read.
+func (t *tailer) read(handle func(line string)) error {
+	for {
+		line, err := t.rd.ReadString('\n')
+		if err == io.EOF {
+			t.partial += line
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		handle(strings.TrimRight(t.partial+line, "\r\n"))
+		t.partial = ""
+	}
+}
+
+func (t *tailer) close() {
+	t.f.Close()
+	t.f, t.fi, t.rd, t.partial = nil, nil, nil, ""
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_Tailer(t *testing.T) {
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "named.log")
+	write := func(flag int, s string) {
+		f, err := os.OpenFile(path, flag|os.O_WRONLY|os.O_CREATE, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tail := newTailer(path)
+	poll := func() []string {
+		var lines []string
+		if err := tail.poll(func(line string) { lines = append(lines, line) }); err != nil {
+			t.Fatal(err)
+		}
+		return lines
+	}
+
+	write(os.O_APPEND, "before start\n")
+	if lines := poll(); lines != nil {
+		t.Errorf("lines written before the start are read: %q", lines)
+	}
+	write(os.O_APPEND, "one\ntw")
+	if lines := poll(); !reflect.DeepEqual(lines, []string{"one"}) {
+		t.Errorf("got %q", lines)
+	}
+	write(os.O_APPEND, "o\n")
+	if lines := poll(); !reflect.DeepEqual(lines, []string{"two"}) {
+		t.Errorf("partial line: got %q", lines)
+	}
+
+	// lines written before and after a rotation are all read once
+	write(os.O_APPEND, "three\n")
+	if err := os.Rename(path, path+".0"); err != nil {
+		t.Fatal(err)
+	}
+	write(os.O_APPEND, "four\n")
+	if lines := poll(); !reflect.DeepEqual(lines, []string{"three", "four"}) {
+		t.Errorf("rotation: got %q", lines)
+	}
+
+	write(os.O_TRUNC, "5\n")
+	if lines := poll(); !reflect.DeepEqual(lines, []string{"5"}) {
+		t.Errorf("truncation: got %q", lines)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if lines := poll(); lines != nil {
+		t.Errorf("removed: got %q", lines)
+	}
+	write(os.O_APPEND, "six\n")
+	if lines := poll(); !reflect.DeepEqual(lines, []string{"six"}) {
+		t.Errorf("recreated: got %q", lines)
+	}
+}
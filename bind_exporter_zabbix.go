@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// zoneViewReg splits per zone sections like "example.com (view: internal)".
+var zoneViewReg = regexp.MustCompile(`^(\S+)(?:\s+\(view:\s*(.*)\))?$`)
+
+// viewSections are the dump sections whose modules are views. The per zone
+// sections use the same bracket syntax for zone names.
+var viewSections = []string{"Outgoing Queries", "Resolver Statistics", "Cache DB RRsets"}
+
+// zabbixCache hands out a recent dump to Zabbix agent calls, so that rndc
+// is triggered once per max age instead of once per item.
+type zabbixCache struct {
+	bindSh    *string
+	bindStats *string
+	cacheFile *string
+	maxAge    *time.Duration
+}
+
+func newZabbixFlags(name string, out io.Writer) (*flag.FlagSet, *zabbixCache) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(out)
+	return fs, &zabbixCache{
+		bindSh:    fs.String("bind.sh", "./stats.sh", "Path name of shell."),
+		bindStats: fs.String("bind.stats-file", "/var/named/data/named_stats.txt", "Path name of the status statistics file output by Bind DNS."),
+		cacheFile: fs.String("cache-file", "/var/tmp/bind_stats_exporter.zabbix.json", "File keeping the last parsed dump."),
+		maxAge:    fs.Duration("cache.max-age", 30*time.Second, "Age after which the cached dump is replaced by a new one."),
+	}
+}
+
+// parseInterspersed parses flags that may come before, between or after the
+// positional arguments and returns the positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// snapshot returns the cached dump, triggering a new one if it is older than
+// the max age. Concurrent callers are serialized with a lock file, so only
+// one of them runs the trigger.
+func (z *zabbixCache) snapshot() (*StatusInfo, error) {
+	lock, err := os.OpenFile(*z.cacheFile+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Close()
+	unlock, err := lockFile(lock)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if fi, err := os.Stat(*z.cacheFile); err == nil && time.Since(fi.ModTime()) < *z.maxAge {
+		if statsInfo, err := loadSnapshot(*z.cacheFile); err == nil && statsInfo != nil {
+			return statsInfo, nil
+		}
+	}
+	collector := NewStatsCollector(StatsCollectorOpts{FilePath: *z.bindStats, Script: *z.bindSh})
+	statsInfo, err := collector.scrape()
+	if err != nil {
+		return nil, err
+	}
+	return statsInfo, saveSnapshot(*z.cacheFile, statsInfo)
+}
+
+// runDiscover implements `discover views|zones|sections`, printing Zabbix
+// low-level discovery JSON.
+func runDiscover(args []string, out io.Writer) int {
+	fs, cache := newZabbixFlags("discover", out)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 1 {
+		fmt.Fprintln(out, "Usage: discover views|zones|sections [flags]")
+		return 2
+	}
+	statsInfo, err := cache.snapshot()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	data, err := discoverEntries(statsInfo, positional[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	content, err := json.Marshal(map[string][]map[string]string{"data": data})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprintln(out, string(content))
+	return 0
+}
+
+func discoverEntries(statsInfo *StatusInfo, kind string) ([]map[string]string, error) {
+	data := []map[string]string{}
+	seen := map[string]bool{}
+	add := func(entry map[string]string) {
+		key := fmt.Sprint(entry)
+		if !seen[key] {
+			seen[key] = true
+			data = append(data, entry)
+		}
+	}
+	switch kind {
+	case "sections":
+		for _, section := range sortedSections(statsInfo) {
+			add(map[string]string{"{#SECTION}": section})
+		}
+	case "views":
+		var views []string
+		for _, section := range viewSections {
+			for _, md := range statsInfo.ModuleMap[section] {
+				// [Common] in the resolver statistics is not a view.
+				if view := cacheViewName(md.View); view != "" && view != "Common" {
+					views = append(views, view)
+				}
+			}
+		}
+		sort.Strings(views)
+		for _, view := range views {
+			add(map[string]string{"{#VIEW}": view})
+		}
+	case "zones":
+		for _, md := range statsInfo.ModuleMap["Per Zone Query Statistics"] {
+			if m := zoneViewReg.FindStringSubmatch(md.View); m != nil {
+				view := m[2]
+				if view == "" {
+					view = "_default"
+				}
+				add(map[string]string{"{#ZONE}": m[1], "{#VIEW}": view})
+			}
+		}
+	default:
+		return nil, fmt.Errorf("Unknown discovery %q, want views, zones or sections", kind)
+	}
+	return data, nil
+}
+
+// runGet implements `get <section> <view> <counter>`, printing one value of
+// the cached dump. Sections without views take "" or "-" as view.
+func runGet(args []string, out io.Writer) int {
+	fs, cache := newZabbixFlags("get", out)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return 2
+	}
+	if len(positional) != 3 {
+		fmt.Fprintln(out, "Usage: get <section> <view> <counter> [flags]")
+		return 2
+	}
+	statsInfo, err := cache.snapshot()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	value, ok := lookupCounter(statsInfo, positional[0], positional[1], positional[2])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "No counter %q in view %q of section %q\n", positional[2], positional[1], positional[0])
+		return 1
+	}
+	fmt.Fprintln(out, plainFloat(value))
+	return 0
+}
+
+func lookupCounter(statsInfo *StatusInfo, section, view, counter string) (float64, bool) {
+	if view == "-" {
+		view = ""
+	}
+	for _, md := range statsInfo.ModuleMap[section] {
+		if md.View != view && cacheViewName(md.View) != view {
+			continue
+		}
+		if value, ok := md.Info[strings.TrimSpace(counter)]; ok {
+			return value, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const perZoneStats = `++ Per Zone Query Statistics ++
+[example.com (view: view_bj_ali)]
+                  42 QrySuccess
+[example.org]
+                   7 QrySuccess
+`
+
+func Test_ParseInterspersed(t *testing.T) {
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	file := fs.String("bind.stats-file", "", "")
+	positional, err := parseInterspersed(fs, []string{"Incoming Queries", "--bind.stats-file", "x", "-", "A"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *file != "x" || !reflect.DeepEqual(positional, []string{"Incoming Queries", "-", "A"}) {
+		t.Errorf("file = %q, positional = %q", *file, positional)
+	}
+}
+
+func Test_DiscoverEntries(t *testing.T) {
+
+	statsInfo := ParserStats(strings.Replace(str, "++ Per Zone Query Statistics ++\n", perZoneStats, 1))
+	zones, err := discoverEntries(statsInfo, "zones")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]string{
+		{"{#ZONE}": "example.com", "{#VIEW}": "view_bj_ali"},
+		{"{#ZONE}": "example.org", "{#VIEW}": "_default"},
+	}
+	if !reflect.DeepEqual(zones, want) {
+		t.Errorf("zones = %v, want %v", zones, want)
+	}
+	views, _ := discoverEntries(statsInfo, "views")
+	for _, entry := range views {
+		if view := entry["{#VIEW}"]; view == "Common" || strings.Contains(view, "Cache:") || strings.HasPrefix(view, "example.") {
+			t.Errorf("unexpected view %v", entry)
+		}
+	}
+	if len(views) == 0 {
+		t.Error("no views discovered")
+	}
+	if _, err := discoverEntries(statsInfo, "counters"); err == nil {
+		t.Error("expected an error for an unknown discovery")
+	}
+}
+
+func Test_RunGet(t *testing.T) {
+
+	dir := t.TempDir()
+	statsFile := filepath.Join(dir, "named.stats")
+	script := filepath.Join(dir, "stats.sh")
+	count := filepath.Join(dir, "count")
+	content := "echo x >> " + count + "\ncat > " + statsFile + " <<'DUMP'\n" + str + "\nDUMP\n"
+	if err := ioutil.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+	get := func(args ...string) (int, string) {
+		var out bytes.Buffer
+		status := runGet(append(args,
+			"--bind.sh", script,
+			"--bind.stats-file", statsFile,
+			"--cache-file", filepath.Join(dir, "cache.json"),
+		), &out)
+		return status, strings.TrimSpace(out.String())
+	}
+
+	if status, out := get("Name Server Statistics", "-", "queries resulted in SERVFAIL"); status != 0 || out != "287491" {
+		t.Errorf("got %d %q", status, out)
+	}
+	if status, out := get("Resolver Statistics", "view_bj_mjq", "query timeouts"); status != 0 || out != "1067167" {
+		t.Errorf("got %d %q", status, out)
+	}
+	if status, _ := get("Resolver Statistics", "view_bj_mjq", "no such counter"); status != 1 {
+		t.Errorf("status = %d for a missing counter", status)
+	}
+	runs, err := ioutil.ReadFile(count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(runs), "x"); n != 1 {
+		t.Errorf("dump triggered %d times, want once", n)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+var (
+	zoneFileLabels = []string{"zone", "view", "file"}
+
+	zoneFileReadSuccess = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "zone_file", "read_success"),
+		"Could the zone file be parsed?",
+		zoneFileLabels, nil,
+	)
+	zoneFileSerial = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "zone_file", "serial"),
+		"SOA serial of the zone file.",
+		zoneFileLabels, nil,
+	)
+	zoneFileSOATimers = map[string]*prometheus.Desc{
+		"refresh": prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "zone_file", "soa_refresh_seconds"),
+			"SOA refresh of the zone file.",
+			zoneFileLabels, nil,
+		),
+		"retry": prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "zone_file", "soa_retry_seconds"),
+			"SOA retry of the zone file.",
+			zoneFileLabels, nil,
+		),
+		"expire": prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "zone_file", "soa_expire_seconds"),
+			"SOA expire of the zone file.",
+			zoneFileLabels, nil,
+		),
+		"minimum": prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "zone_file", "soa_minimum_seconds"),
+			"SOA minimum, the negative caching TTL, of the zone file.",
+			zoneFileLabels, nil,
+		),
+	}
+	zoneFileRecords = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "zone_file", "records"),
+		"Number of records in the zone file by type.",
+		[]string{"zone", "view", "file", "type"}, nil,
+	)
+	zoneFileRRSIGExpiration = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "zone_file", "rrsig_expiration_timestamp_seconds"),
+		"Earliest expiration of the RRSIGs in the zone file since unix epoch in seconds.",
+		zoneFileLabels, nil,
+	)
+)
+
+// ZoneFileInfo is what the scanner found in a zone file.
+type ZoneFileInfo struct {
+	SOA *dns.SOA
+	// Records counts the records by type.
+	Records map[string]float64
+	// RRSIGExpiration is the earliest RRSIG expiration, zero if unsigned.
+	RRSIGExpiration time.Time
+}
+
+// ParserZoneFile scans a zone file in text format. Zone files in raw or map
+// format, the default for secondaries since BIND 9.9, can't be read.
+func ParserZoneFile(r io.Reader, origin, path string) (*ZoneFileInfo, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(512)
+	if bytes.IndexByte(head, 0) >= 0 {
+		return nil, fmt.Errorf("%s is not in text format, set masterfile-format text to scan it", path)
+	}
+	info := &ZoneFileInfo{Records: map[string]float64{}}
+	zp := dns.NewZoneParser(br, dns.Fqdn(origin), path)
+	zp.SetIncludeAllowed(true)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		info.Records[dns.TypeToString[rr.Header().Rrtype]]++
+		switch rr := rr.(type) {
+		case *dns.SOA:
+			if info.SOA == nil {
+				info.SOA = rr
+			}
+		case *dns.RRSIG:
+			expiration := time.Unix(int64(rr.Expiration), 0)
+			if info.RRSIGExpiration.IsZero() || expiration.Before(info.RRSIGExpiration) {
+				info.RRSIGExpiration = expiration
+			}
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+	if info.SOA == nil {
+		return nil, fmt.Errorf("%s has no SOA record", path)
+	}
+	return info, nil
+}
+
+// parseZoneFileArg parses a zone file flag given as name=path or
+// name@view=path.
+func parseZoneFileArg(arg string) (NamedZone, error) {
+	i := strings.Index(arg, "=")
+	if i <= 0 || i == len(arg)-1 {
+		return NamedZone{}, fmt.Errorf("Zone file %q is not in name=path or name@view=path form", arg)
+	}
+	zone := parseZoneArg(arg[:i])
+	zone.File = arg[i+1:]
+	return zone, nil
+}
+
+// fileZones returns the zones of named.conf with a file, resolved against
+// the directory and chroot.
+func fileZones(conf *NamedConf) []NamedZone {
+	var zones []NamedZone
+	for _, zone := range conf.Zones {
+		switch zone.Type {
+		case "master", "primary", "slave", "secondary", "mirror", "redirect":
+		default:
+			continue
+		}
+		if zone.File == "" {
+			continue
+		}
+		zone.File = conf.Path(zone.File)
+		zones = append(zones, zone)
+	}
+	return zones
+}
+
+type zoneFileCacheEntry struct {
+	modTime time.Time
+	size    int64
+	info    *ZoneFileInfo
+	err     error
+}
+
+type zoneFileCollector struct {
+	zones []NamedZone
+
+	mu    sync.Mutex
+	cache map[string]zoneFileCacheEntry
+}
+
+// NewZoneFileCollector scans the files of zones, and their .signed files if
+// present. A file is parsed again only when it changed.
+func NewZoneFileCollector(zones []NamedZone) prometheus.Collector {
+	return &zoneFileCollector{zones: zones, cache: map[string]zoneFileCacheEntry{}}
+}
+
+// Describe implements prometheus.Collector.
+func (c *zoneFileCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- zoneFileReadSuccess
+	ch <- zoneFileSerial
+	for _, desc := range zoneFileSOATimers {
+		ch <- desc
+	}
+	ch <- zoneFileRecords
+	ch <- zoneFileRRSIGExpiration
+}
+
+func (c *zoneFileCollector) scan(zone NamedZone, path string) (*ZoneFileInfo, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	entry, ok := c.cache[path]
+	c.mu.Unlock()
+	if ok && entry.modTime.Equal(fi.ModTime()) && entry.size == fi.Size() {
+		return entry.info, entry.err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := ParserZoneFile(f, zone.Name, path)
+	c.mu.Lock()
+	c.cache[path] = zoneFileCacheEntry{modTime: fi.ModTime(), size: fi.Size(), info: info, err: err}
+	c.mu.Unlock()
+	return info, err
+}
+
+// Collect implements prometheus.Collector. Inline signed zones are scanned in
+// their .signed file too, if there is one.
+func (c *zoneFileCollector) Collect(ch chan<- prometheus.Metric) {
+	seen := map[NamedZone]bool{}
+	for _, zone := range c.zones {
+		for _, path := range []string{zone.File, zone.File + ".signed"} {
+			key := NamedZone{Name: zone.Name, View: zone.View, File: path}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			labels := []string{zone.Name, zone.View, path}
+			info, err := c.scan(zone, path)
+			if os.IsNotExist(err) && path != zone.File {
+				continue
+			}
+			if err != nil {
+				log.Errorf("Can't scan zone file of %s: %s", zone.Name, err)
+				ch <- prometheus.MustNewConstMetric(zoneFileReadSuccess, prometheus.GaugeValue, 0, labels...)
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(zoneFileReadSuccess, prometheus.GaugeValue, 1, labels...)
+			ch <- prometheus.MustNewConstMetric(zoneFileSerial, prometheus.GaugeValue, float64(info.SOA.Serial), labels...)
+			for name, v := range map[string]uint32{
+				"refresh": info.SOA.Refresh,
+				"retry":   info.SOA.Retry,
+				"expire":  info.SOA.Expire,
+				"minimum": info.SOA.Minttl,
+			} {
+				ch <- prometheus.MustNewConstMetric(zoneFileSOATimers[name], prometheus.GaugeValue, float64(v), labels...)
+			}
+			for rrtype, v := range info.Records {
+				ch <- prometheus.MustNewConstMetric(zoneFileRecords, prometheus.GaugeValue, v, append(labels, rrtype)...)
+			}
+			if !info.RRSIGExpiration.IsZero() {
+				ch <- prometheus.MustNewConstMetric(
+					zoneFileRRSIGExpiration, prometheus.GaugeValue, float64(info.RRSIGExpiration.Unix()), labels...,
+				)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_ZoneFileCollector(t *testing.T) {
+
+	raw := filepath.Join(t.TempDir(), "example.net.db")
+	if err := ioutil.WriteFile(raw, []byte{0, 0, 0, 2, 0, 0, 0, 1}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	zone, err := parseZoneFileArg("example.com@internal=testdata/zones/example.com.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(NewZoneFileCollector([]NamedZone{zone, {Name: "example.net", View: "_default", File: raw}}))
+	want := `# HELP bind_zone_file_read_success Could the zone file be parsed?
+# TYPE bind_zone_file_read_success gauge
+bind_zone_file_read_success{file="` + raw + `",view="_default",zone="example.net"} 0
+bind_zone_file_read_success{file="testdata/zones/example.com.db",view="internal",zone="example.com"} 1
+bind_zone_file_read_success{file="testdata/zones/example.com.db.signed",view="internal",zone="example.com"} 1
+# HELP bind_zone_file_records Number of records in the zone file by type.
+# TYPE bind_zone_file_records gauge
+bind_zone_file_records{file="testdata/zones/example.com.db",type="A",view="internal",zone="example.com"} 3
+bind_zone_file_records{file="testdata/zones/example.com.db",type="AAAA",view="internal",zone="example.com"} 1
+bind_zone_file_records{file="testdata/zones/example.com.db",type="MX",view="internal",zone="example.com"} 1
+bind_zone_file_records{file="testdata/zones/example.com.db",type="NS",view="internal",zone="example.com"} 2
+bind_zone_file_records{file="testdata/zones/example.com.db",type="SOA",view="internal",zone="example.com"} 1
+bind_zone_file_records{file="testdata/zones/example.com.db.signed",type="A",view="internal",zone="example.com"} 1
+bind_zone_file_records{file="testdata/zones/example.com.db.signed",type="NS",view="internal",zone="example.com"} 1
+bind_zone_file_records{file="testdata/zones/example.com.db.signed",type="RRSIG",view="internal",zone="example.com"} 3
+bind_zone_file_records{file="testdata/zones/example.com.db.signed",type="SOA",view="internal",zone="example.com"} 1
+# HELP bind_zone_file_serial SOA serial of the zone file.
+# TYPE bind_zone_file_serial gauge
+bind_zone_file_serial{file="testdata/zones/example.com.db",view="internal",zone="example.com"} 2.024090501e+09
+bind_zone_file_serial{file="testdata/zones/example.com.db.signed",view="internal",zone="example.com"} 2.024090503e+09
+# HELP bind_zone_file_soa_expire_seconds SOA expire of the zone file.
+# TYPE bind_zone_file_soa_expire_seconds gauge
+bind_zone_file_soa_expire_seconds{file="testdata/zones/example.com.db",view="internal",zone="example.com"} 1.2096e+06
+bind_zone_file_soa_expire_seconds{file="testdata/zones/example.com.db.signed",view="internal",zone="example.com"} 1.2096e+06
+`
+	names := []string{"bind_zone_file_read_success", "bind_zone_file_records", "bind_zone_file_serial", "bind_zone_file_soa_expire_seconds"}
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want), names...); err != nil {
+		t.Error(err)
+	}
+
+	mfs, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != "bind_zone_file_rrsig_expiration_timestamp_seconds" {
+			continue
+		}
+		want := float64(time.Date(2024, 9, 20, 9, 12, 45, 0, time.UTC).Unix())
+		if len(mf.GetMetric()) != 1 || mf.GetMetric()[0].GetGauge().GetValue() != want {
+			t.Errorf("got %v, want the earliest expiration %v", mf.GetMetric(), want)
+		}
+		return
+	}
+	t.Error("no RRSIG expiration exported")
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/log"
+)
+
+var (
+	zoneLabels = []string{"zone", "view"}
+
+	zoneSerial = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "zone", "serial"),
+		"Serial of the zone, the signed serial for inline signed zones.",
+		zoneLabels, nil,
+	)
+	zoneLoaded = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "zone", "loaded"),
+		"Is the zone loaded, as reported by rndc zonestatus?",
+		zoneLabels, nil,
+	)
+	zoneDynamic = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "zone", "dynamic"),
+		"Is the zone dynamic?",
+		zoneLabels, nil,
+	)
+	zoneLoadedTime = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "zone", "loaded_timestamp_seconds"),
+		"Time the zone was last loaded since unix epoch in seconds.",
+		zoneLabels, nil,
+	)
+	zoneLastRefreshTime = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "zone", "last_refresh_timestamp_seconds"),
+		"Time of the last successful refresh of a secondary zone since unix epoch in seconds.",
+		zoneLabels, nil,
+	)
+	zoneRefreshTime = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "zone", "refresh_timestamp_seconds"),
+		"Time of the next refresh of a secondary zone since unix epoch in seconds.",
+		zoneLabels, nil,
+	)
+	zoneExpiresTime = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "zone", "expires_timestamp_seconds"),
+		"Time a secondary zone expires unless refreshed since unix epoch in seconds.",
+		zoneLabels, nil,
+	)
+)
+
+// ZoneStatus is the parsed output of rndc zonestatus.
+type ZoneStatus struct {
+	Name       string
+	Type       string
+	Serial     float64
+	Dynamic    bool
+	LastLoaded time.Time
+	// LastRefresh, NextRefresh and Expires are only reported for secondary
+	// zones.
+	LastRefresh time.Time
+	NextRefresh time.Time
+	Expires     time.Time
+}
+
+// ParserZoneStatus parses the output of rndc zonestatus.
+func ParserZoneStatus(out string) *ZoneStatus {
+	status := &ZoneStatus{Serial: -1}
+	signed := false
+	for _, line := range strings.Split(out, "\n") {
+		i := strings.Index(line, ": ")
+		if i < 0 {
+			continue
+		}
+		key, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+2:])
+		parseTime := func() time.Time {
+			t, _ := time.Parse(time.RFC1123, value)
+			return t
+		}
+		switch key {
+		case "name":
+			status.Name = value
+		case "type":
+			status.Type = value
+		case "serial":
+			if !signed {
+				status.Serial = parseRndcNumber(value)
+			}
+		case "signed serial":
+			signed = true
+			status.Serial = parseRndcNumber(value)
+		case "dynamic":
+			status.Dynamic = value == "yes"
+		case "last loaded":
+			status.LastLoaded = parseTime()
+		case "last refresh", "last refreshed", "refreshed":
+			status.LastRefresh = parseTime()
+		case "next refresh":
+			status.NextRefresh = parseTime()
+		case "expires":
+			status.Expires = parseTime()
+		}
+	}
+	return status
+}
+
+// parseZoneArg parses a zone given as name or name@view. The separator is not
+// "/", which RFC 2317 classless reverse zones like 0/26.2.0.192.in-addr.arpa
+// contain.
+func parseZoneArg(arg string) NamedZone {
+	zone := NamedZone{Name: arg, View: "_default"}
+	if i := strings.Index(arg, "@"); i > 0 {
+		zone.Name, zone.View = arg[:i], arg[i+1:]
+	}
+	return zone
+}
+
+// statusZones returns the zones of named.conf rndc zonestatus knows about.
+func statusZones(conf *NamedConf) []NamedZone {
+	var zones []NamedZone
+	for _, zone := range conf.Zones {
+		switch zone.Type {
+		case "master", "primary", "slave", "secondary", "mirror", "stub", "redirect":
+			zones = append(zones, zone)
+		}
+	}
+	return zones
+}
+
+// ZoneStatusOpts configures the rndc zonestatus collector.
+type ZoneStatusOpts struct {
+	Zones       []NamedZone
+	Concurrency int
+	CacheTTL    time.Duration
+}
+
+// zoneOutput is the output of an rndc command for one zone.
+type zoneOutput struct {
+	out string
+	err error
+	at  time.Time
+}
+
+// zoneCommand runs an rndc command for every zone, at most concurrency at a
+// time, reusing outputs younger than ttl.
+type zoneCommand struct {
+	run         rndcRunner
+	command     []string
+	concurrency int
+	ttl         time.Duration
+
+	mu    sync.Mutex
+	cache map[NamedZone]zoneOutput
+}
+
+func newZoneCommand(run rndcRunner, concurrency int, ttl time.Duration, command ...string) *zoneCommand {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &zoneCommand{
+		run:         run,
+		command:     command,
+		concurrency: concurrency,
+		ttl:         ttl,
+		cache:       map[NamedZone]zoneOutput{},
+	}
+}
+
+func (c *zoneCommand) runZone(zone NamedZone) zoneOutput {
+	c.mu.Lock()
+	output, ok := c.cache[zone]
+	c.mu.Unlock()
+	if ok && time.Since(output.at) < c.ttl {
+		return output
+	}
+	args := append(append([]string{}, c.command...), zone.Name)
+	if zone.View != "_default" {
+		args = append(args, "IN", zone.View)
+	}
+	out, err := c.run(args...)
+	output = zoneOutput{out: out, err: err, at: time.Now()}
+	c.mu.Lock()
+	c.cache[zone] = output
+	c.mu.Unlock()
+	return output
+}
+
+// runAll returns the outputs in the order of zones.
+func (c *zoneCommand) runAll(zones []NamedZone) []zoneOutput {
+	outputs := make([]zoneOutput, len(zones))
+	sem := make(chan struct{}, c.concurrency)
+	var wg sync.WaitGroup
+	for i, zone := range zones {
+		wg.Add(1)
+		go func(i int, zone NamedZone) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			outputs[i] = c.runZone(zone)
+		}(i, zone)
+	}
+	wg.Wait()
+	return outputs
+}
+
+// uniqueZones keeps the first of each zone and view.
+func uniqueZones(zones []NamedZone) []NamedZone {
+	seen := map[NamedZone]bool{}
+	unique := make([]NamedZone, 0, len(zones))
+	for _, zone := range zones {
+		zone = NamedZone{Name: zone.Name, View: zone.View}
+		if !seen[zone] {
+			seen[zone] = true
+			unique = append(unique, zone)
+		}
+	}
+	return unique
+}
+
+type zoneStatusCollector struct {
+	zones   []NamedZone
+	command *zoneCommand
+	up      *prometheus.Desc
+}
+
+// NewZoneStatusCollector runs rndc zonestatus for every zone, at most
+// Concurrency at a time, reusing results younger than CacheTTL.
+func NewZoneStatusCollector(run rndcRunner, opts ZoneStatusOpts) prometheus.Collector {
+	return &zoneStatusCollector{
+		zones:   uniqueZones(opts.Zones),
+		command: newZoneCommand(run, opts.Concurrency, opts.CacheTTL, "zonestatus"),
+		up:      newRndcUpDesc("zonestatus"),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *zoneStatusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.up
+	ch <- zoneSerial
+	ch <- zoneLoaded
+	ch <- zoneDynamic
+	ch <- zoneLoadedTime
+	ch <- zoneLastRefreshTime
+	ch <- zoneRefreshTime
+	ch <- zoneExpiresTime
+}
+
+// Collect implements prometheus.Collector.
+func (c *zoneStatusCollector) Collect(ch chan<- prometheus.Metric) {
+	outputs := c.command.runAll(c.zones)
+	failed := 0
+	for i, zone := range c.zones {
+		output := outputs[i]
+		gauge := func(desc *prometheus.Desc, v float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, zone.Name, zone.View)
+		}
+		timestamp := func(desc *prometheus.Desc, t time.Time) {
+			if !t.IsZero() {
+				gauge(desc, float64(t.Unix()))
+			}
+		}
+		if output.err != nil {
+			log.Errorf("Zone %s in view %s: %s", zone.Name, zone.View, output.err)
+			failed++
+			gauge(zoneLoaded, 0)
+			continue
+		}
+		status := ParserZoneStatus(output.out)
+		gauge(zoneLoaded, 1)
+		if status.Serial >= 0 {
+			gauge(zoneSerial, status.Serial)
+		}
+		gauge(zoneDynamic, boolToFloat(status.Dynamic))
+		timestamp(zoneLoadedTime, status.LastLoaded)
+		timestamp(zoneLastRefreshTime, status.LastRefresh)
+		timestamp(zoneRefreshTime, status.NextRefresh)
+		timestamp(zoneExpiresTime, status.Expires)
+	}
+	ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, zonesUp(len(c.zones), failed))
+}
+
+// zonesUp reports rndc as down only when no zone could be queried, a single
+// failing zone is reported by the per zone metrics.
+func zonesUp(zones, failed int) float64 {
+	if zones > 0 && failed == zones {
+		return 0
+	}
+	return 1
+}
+
+// zoneArgs turns zone flags into zones, keeping their order.
+func zoneArgs(args []string) []NamedZone {
+	zones := make([]NamedZone, 0, len(args))
+	for _, arg := range args {
+		if arg = strings.TrimSpace(arg); arg != "" {
+			zones = append(zones, parseZoneArg(arg))
+		}
+	}
+	return zones
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_ParserZoneStatus(t *testing.T) {
+
+	run := fixtureRunner(t, map[string]string{"zonestatus example.org": "rndc.zonestatus.primary"})
+	out, err := run("zonestatus", "example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := ParserZoneStatus(out)
+	if status.Name != "example.org" || status.Type != "master" || status.Serial != 2024090518 || !status.Dynamic {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if !status.NextRefresh.IsZero() || !status.Expires.IsZero() {
+		t.Errorf("primary zone has refresh %s and expiry %s", status.NextRefresh, status.Expires)
+	}
+}
+
+func Test_ParseZoneArg(t *testing.T) {
+
+	for arg, want := range map[string]NamedZone{
+		"example.com":                        {Name: "example.com", View: "_default"},
+		"example.com@internal":               {Name: "example.com", View: "internal"},
+		"0/26.2.0.192.in-addr.arpa":          {Name: "0/26.2.0.192.in-addr.arpa", View: "_default"},
+		"0/26.2.0.192.in-addr.arpa@internal": {Name: "0/26.2.0.192.in-addr.arpa", View: "internal"},
+	} {
+		if zone := parseZoneArg(arg); zone != want {
+			t.Errorf("parseZoneArg(%q) = %+v, want %+v", arg, zone, want)
+		}
+	}
+}
+
+func Test_ZoneStatusCollector(t *testing.T) {
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	fixtures := fixtureRunner(t, map[string]string{
+		"zonestatus example.com IN internal": "rndc.zonestatus.secondary",
+		"zonestatus example.org":             "rndc.zonestatus.primary",
+	})
+	run := func(args ...string) (string, error) {
+		mu.Lock()
+		calls[strings.Join(args, " ")]++
+		mu.Unlock()
+		return fixtures(args...)
+	}
+	collector := NewZoneStatusCollector(run, ZoneStatusOpts{
+		Zones:       append(zoneArgs([]string{"example.com@internal", "example.org", "broken.example"}), NamedZone{Name: "example.org", View: "_default", Type: "primary"}),
+		Concurrency: 2,
+		CacheTTL:    time.Hour,
+	})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collector)
+	want := `# HELP bind_rndc_up Was the last rndc command successful?
+# TYPE bind_rndc_up gauge
+bind_rndc_up{command="zonestatus"} 1
+# HELP bind_zone_expires_timestamp_seconds Time a secondary zone expires unless refreshed since unix epoch in seconds.
+# TYPE bind_zone_expires_timestamp_seconds gauge
+bind_zone_expires_timestamp_seconds{view="internal",zone="example.com"} 1.59946276e+09
+# HELP bind_zone_last_refresh_timestamp_seconds Time of the last successful refresh of a secondary zone since unix epoch in seconds.
+# TYPE bind_zone_last_refresh_timestamp_seconds gauge
+bind_zone_last_refresh_timestamp_seconds{view="internal",zone="example.com"} 1.59825676e+09
+# HELP bind_zone_loaded Is the zone loaded, as reported by rndc zonestatus?
+# TYPE bind_zone_loaded gauge
+bind_zone_loaded{view="_default",zone="broken.example"} 0
+bind_zone_loaded{view="_default",zone="example.org"} 1
+bind_zone_loaded{view="internal",zone="example.com"} 1
+# HELP bind_zone_refresh_timestamp_seconds Time of the next refresh of a secondary zone since unix epoch in seconds.
+# TYPE bind_zone_refresh_timestamp_seconds gauge
+bind_zone_refresh_timestamp_seconds{view="internal",zone="example.com"} 1.59834316e+09
+# HELP bind_zone_serial Serial of the zone, the signed serial for inline signed zones.
+# TYPE bind_zone_serial gauge
+bind_zone_serial{view="_default",zone="example.org"} 2.024090518e+09
+bind_zone_serial{view="internal",zone="example.com"} 2.020082501e+09
+`
+	names := []string{"bind_rndc_up", "bind_zone_expires_timestamp_seconds", "bind_zone_last_refresh_timestamp_seconds",
+		"bind_zone_loaded", "bind_zone_refresh_timestamp_seconds", "bind_zone_serial"}
+	for i := 0; i < 2; i++ {
+		if err := testutil.GatherAndCompare(registry, strings.NewReader(want), names...); err != nil {
+			t.Error(err)
+		}
+	}
+	for command, n := range calls {
+		if n != 1 {
+			t.Errorf("%q ran %d times, want once thanks to the cache", command, n)
+		}
+	}
+}
@@ -6,8 +6,12 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -20,17 +24,114 @@ const (
 	EXPORTER       = "bind_stats_exporter"
 	RESOLVER_STATS = "resolver_stats"
 	CACHE_STATS    = "cache_stats"
+	STATS          = "stats"
+	DERIVED        = "derived"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "check":
+			os.Exit(runCheck(os.Args[2:], os.Stdout))
+		case "discover":
+			os.Exit(runDiscover(os.Args[2:], os.Stdout))
+		case "get":
+			os.Exit(runGet(os.Args[2:], os.Stdout))
+		}
+	}
+
 	var (
 		bindSh        = flag.String("bind.sh", "./stats.sh", "Path name of shell.")
 		bindStats     = flag.String("bind.stats-file", "/var/named/data/named_stats.txt", "Path name of the status statistics file output by Bind DNS.")
+		bindMemStats  = flag.String("bind.memstats-file", "", "Path to the memstatistics-file to export memory contexts from. Defaults to the memstatistics-file of named.conf if one is set there.")
 		bindPidFile   = flag.String("bind.pid-file", "/run/named/named.pid", "Path to Bind's pid file to export process information.")
+		bindConfig    = flag.String("bind.config", "/etc/named.conf", "Path to named.conf to take the statistics file, pid file and zones from.")
+		bindChroot    = flag.String("bind.chroot", "", "Directory named is chrooted to, prepended to the statistics file, pid file, config and the paths found in it.")
+		bindStale     = flag.Duration("bind.stale-grace", 0, "Keep exporting the last successful statistics dump for this long after the dump failed, with bind_stats_stale 1.")
+		bindMinIntvl  = flag.Duration("bind.min-interval", 0, "Reuse a statistics dump younger than this instead of running --bind.sh again. Concurrent scrapes always share one dump.")
+		bindTimestamp = flag.Bool("bind.stats-timestamp", false, "Attach the timestamp of the statistics dump to every sample instead of the scrape time.")
+		bindRndc      = flag.String("bind.rndc", "/usr/sbin/rndc", "Path to rndc, used by the rndc collectors.")
+		rndcTimeout   = flag.Duration("bind.rndc-timeout", 10*time.Second, "Timeout of a single rndc command.")
+		rndcStatus    = flag.Bool("collector.rndc-status", false, "Export the output of rndc status, such as recursive and TCP clients.")
+		recursing     = flag.Bool("collector.rndc-recursing", false, "Run rndc recursing on every scrape and export the in-flight recursive queries.")
+		recursingFile = flag.String("bind.recursing-file", "/var/named/named.recursing", "Path of the file rndc recursing writes to.")
+		recursingTopN = flag.Int("collector.rndc-recursing.top-n", 10, "Number of domains exported with in-flight recursive queries, the others are summed up.")
+		zoneStatus    = flag.Bool("collector.rndc-zonestatus", false, "Run rndc zonestatus for the zones of named.conf or --collector.rndc-zonestatus.zone and export serial, refresh and expiry.")
+		zoneStatusCon = flag.Int("collector.rndc-zonestatus.concurrency", 4, "Number of rndc zonestatus or dnssec -status commands run at once.")
+		zoneStatusTTL = flag.Duration("collector.rndc-zonestatus.cache-ttl", time.Minute, "Age after which rndc zonestatus and dnssec -status of a zone are run again.")
+		zoneStatusArg stringsFlag
+		dnssecStatus  = flag.Bool("collector.rndc-dnssec", false, "Run rndc dnssec -status for the dnssec-policy zones of named.conf or --collector.rndc-dnssec.zone and export key states.")
+		dnssecZoneArg stringsFlag
+		dnssecKeys    = flag.Bool("collector.dnssec-keys", false, "Export the timing metadata of the DNSSEC keys in the key directories.")
+		dnssecKeyDirs stringsFlag
+		zoneFiles     = flag.Bool("collector.zone-files", false, "Scan the zone files of named.conf or --collector.zone-files.zone for SOA values, record counts and RRSIG expiry.")
+		zoneFileArgs  stringsFlag
+		disk          = flag.Bool("collector.disk", false, "Export the size of zone files and journals and the free space of the directories named writes to.")
+		diskDirs      stringsFlag
+		queryLog      = flag.Bool("collector.querylog", false, "Follow the query log and count queries by view, type and flags and the top client subnets and name suffixes.")
+		queryLogFile  = flag.String("collector.querylog.file", "/var/named/data/queries.log", "Path of the file the queries category is logged to.")
+		queryLogTopN  = flag.Int("collector.querylog.top-n", 10, "Number of client subnets and name suffixes exported with the most queries.")
+		queryLogCap   = flag.Int("collector.querylog.capacity", 1000, "Number of client subnets and name suffixes tracked to find the top ones, bounding the memory used.")
+		queryLogV4    = flag.Int("collector.querylog.ipv4-prefix", 24, "Prefix length IPv4 clients are grouped by.")
+		queryLogV6    = flag.Int("collector.querylog.ipv6-prefix", 48, "Prefix length IPv6 clients are grouped by.")
+		queryLogLbls  = flag.Int("collector.querylog.suffix-labels", 2, "Number of labels of the name suffixes queries are grouped by.")
+		namedLog      = flag.Bool("collector.log", false, "Follow the named log and count the lines matching the log rules.")
+		namedLogFile  = flag.String("collector.log.file", "/var/named/data/named.log", "Path of the file named logs to, with print-category and print-severity for the category and severity labels.")
+		namedLogRules = flag.String("collector.log.rules", "", "JSON file with rules added to the default ones, as a list of objects with name, regex and optionally category.")
+		dnstapOn      = flag.Bool("collector.dnstap", false, "Receive dnstap messages from named and export response latency by view, query type and rcode.")
+		dnstapSocket  = flag.String("collector.dnstap.socket", "/var/named/dnstap.sock", "Unix socket to listen on for dnstap, as in dnstap-output unix of named.conf.")
+		dnstapViews   stringsFlag
+		probeServer   = flag.String("collector.probe.server", "127.0.0.1:53", "Address the probes are sent to over udp and tcp.")
+		probeTLS      = flag.String("collector.probe.tls-server", "127.0.0.1:853", "Address the probes are sent to over tls.")
+		probeInsecure = flag.Bool("collector.probe.tls-insecure", false, "Don't verify the certificate of --collector.probe.tls-server.")
+		probeTimeout  = flag.Duration("collector.probe.timeout", 2*time.Second, "Timeout of a single probe.")
+		probeArgs     stringsFlag
+		derived       = flag.Bool("collector.derived", false, "Export ratios such as the cache hit ratio computed from the increase of counters between two dumps.")
 		showVersion   = flag.Bool("version", false, "Print version information.")
 		listenAddress = flag.String("web.listen-address", ":9219", "Address to listen on for web interface and telemetry.")
 		metricsPath   = flag.String("web.telemetry-path", "/metrics", "Path under which to expose metrics.")
+		pushURL       = flag.String("push.url", "", "Pushgateway URL to push metrics to instead of serving them over HTTP.")
+		pushJob       = flag.String("push.job", "bind", "Job name used when pushing to the Pushgateway.")
+		pushInterval  = flag.Duration("push.interval", time.Minute, "Interval between two pushes to the Pushgateway.")
+		pushUsername  = flag.String("push.username", "", "Username for basic auth against the Pushgateway.")
+		pushPassword  = flag.String("push.password-file", "", "File holding the password for basic auth against the Pushgateway.")
+		pushRetries   = flag.Int("push.retries", 3, "Number of retries after a failed push.")
+		pushBackoff   = flag.Duration("push.retry-backoff", time.Second, "Wait before the first retry of a failed push, doubled on each retry.")
+		pushGrouping  = labelsFlag{}
+		rwURL         = flag.String("remote-write.url", "", "Prometheus remote_write endpoint to send metrics to instead of serving them over HTTP.")
+		rwInterval    = flag.Duration("remote-write.interval", 30*time.Second, "Interval between two collections sent to the remote_write endpoint.")
+		rwUsername    = flag.String("remote-write.username", "", "Username for basic auth against the remote_write endpoint.")
+		rwPassword    = flag.String("remote-write.password-file", "", "File holding the password for basic auth against the remote_write endpoint.")
+		rwTimeout     = flag.Duration("remote-write.timeout", 30*time.Second, "Timeout of a single remote_write request.")
+		rwQueueSize   = flag.Int("remote-write.queue-size", 120, "Maximum number of requests kept while the remote_write endpoint is unreachable.")
+		rwQueueDir    = flag.String("remote-write.queue-dir", "", "Directory to keep queued remote_write requests in across restarts. Kept in memory if empty.")
+		rwLabels      = labelsFlag{}
+		otlpEndpoint  = flag.String("otlp.endpoint", "", "OpenTelemetry collector endpoint to export metrics to instead of serving them over HTTP.")
+		otlpProtocol  = flag.String("otlp.protocol", "http", "OTLP transport, http or grpc.")
+		otlpInterval  = flag.Duration("otlp.interval", 30*time.Second, "Interval between two exports to the OpenTelemetry collector.")
+		otlpInsecure  = flag.Bool("otlp.insecure", false, "Talk to the OpenTelemetry collector without TLS.")
+		otlpTimeout   = flag.Duration("otlp.timeout", 10*time.Second, "Timeout of a single OTLP export.")
+		otlpInstance  = flag.String("otlp.instance", "", "Value of the service.instance.id resource attribute. Defaults to the hostname.")
+		influxOutput  = flag.String("influx.output", "", "Write InfluxDB line protocol to udp://host:port, tcp://host:port or file:///path.")
+		influxIntvl   = flag.Duration("influx.interval", time.Minute, "Interval between two InfluxDB line protocol writes.")
+		graphiteOut   = flag.String("graphite.output", "", "Write Graphite plaintext to udp://host:port, tcp://host:port or file:///path.")
+		graphiteIntvl = flag.Duration("graphite.interval", time.Minute, "Interval between two Graphite plaintext writes.")
+		textfileOut   = flag.String("textfile.output", "", "Write all metrics to this file for the node_exporter textfile collector instead of serving them over HTTP.")
+		textfileIntvl = flag.Duration("textfile.interval", time.Minute, "Interval between two writes of the textfile.")
+		otlpHeaders   = labelsFlag{}
+		otlpResource  = labelsFlag{}
 	)
+	flag.Var(&zoneStatusArg, "collector.rndc-zonestatus.zone", "Zone as name or name@view to run rndc zonestatus for, may be repeated. Defaults to the zones of named.conf.")
+	flag.Var(&dnssecKeyDirs, "collector.dnssec-keys.dir", "Key directory to scan for DNSSEC keys, may be repeated. Defaults to key-directory of named.conf.")
+	flag.Var(&dnssecZoneArg, "collector.rndc-dnssec.zone", "Zone as name or name@view to run rndc dnssec -status for, may be repeated. Defaults to the dnssec-policy zones of named.conf.")
+	flag.Var(&zoneFileArgs, "collector.zone-files.zone", "Zone file as name=path or name@view=path to scan, may be repeated. Defaults to the zone files of named.conf.")
+	flag.Var(&diskDirs, "collector.disk.dir", "Directory to walk for journals and report the filesystem of, may be repeated. Defaults to the directory of named.conf and of the statistics file.")
+	flag.Var(&dnstapViews, "collector.dnstap.view", "View of the clients in a subnet as name=cidr, may be repeated. dnstap messages don't carry the view, clients in no subnet are in view _default.")
+	flag.Var(&probeArgs, "collector.probe", "Query sent to the server on every scrape as name,type[,transport[,rcode]], transport udp, tcp or tls, may be repeated.")
+	flag.Var(pushGrouping, "push.grouping", "Grouping label in name=value form, may be repeated. Defaults to instance=<hostname>.")
+	flag.Var(rwLabels, "remote-write.external-label", "Label in name=value form added to every series, may be repeated. Defaults to job=bind and instance=<hostname>.")
+	flag.Var(otlpHeaders, "otlp.header", "Header in name=value form sent with every OTLP export, may be repeated.")
+	flag.Var(otlpResource, "otlp.resource-attribute", "Resource attribute in name=value form, may be repeated.")
 	flag.Parse()
 
 	if *showVersion {
@@ -40,10 +141,201 @@ func main() {
 	log.Infoln("Starting", EXPORTER, version.Info())
 	log.Infoln("Build context", version.BuildContext())
 
-	prometheus.MustRegister(
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+	*bindConfig = chrootPath(*bindChroot, *bindConfig)
+	*bindStats = chrootPath(*bindChroot, *bindStats)
+	*bindPidFile = chrootPath(*bindChroot, *bindPidFile)
+	*bindMemStats = chrootPath(*bindChroot, *bindMemStats)
+	*recursingFile = chrootPath(*bindChroot, *recursingFile)
+	*queryLogFile = chrootPath(*bindChroot, *queryLogFile)
+	*namedLogFile = chrootPath(*bindChroot, *namedLogFile)
+	*dnstapSocket = chrootPath(*bindChroot, *dnstapSocket)
+	namedConf := loadNamedConf(*bindConfig, *bindChroot, explicit["bind.config"])
+	if namedConf != nil {
+		if !explicit["bind.stats-file"] {
+			*bindStats = namedConf.StatsFile()
+			log.Infof("Using statistics-file %s from %s", *bindStats, *bindConfig)
+		}
+		if !explicit["bind.pid-file"] && namedConf.PidFile != "" {
+			*bindPidFile = namedConf.Path(namedConf.PidFile)
+			log.Infof("Using pid-file %s from %s", *bindPidFile, *bindConfig)
+		}
+		if !explicit["bind.memstats-file"] && namedConf.MemStatisticsFile != "" {
+			*bindMemStats = namedConf.MemStatsFile()
+			log.Infof("Using memstatistics-file %s from %s", *bindMemStats, *bindConfig)
+		}
+		if !explicit["bind.recursing-file"] {
+			*recursingFile = namedConf.RecursingFilePath()
+		}
+	}
+	for _, warning := range validatePaths(namedConf, *bindChroot, *bindStats, *bindPidFile, explicit) {
+		log.Warn(warning)
+	}
+
+	statsCollector := NewStatsCollector(StatsCollectorOpts{
+		FilePath:      *bindStats,
+		Script:        *bindSh,
+		MemStatsFile:  *bindMemStats,
+		DumpTimestamp: *bindTimestamp,
+		Derived:       *derived,
+		StaleGrace:    *bindStale,
+		MinInterval:   *bindMinIntvl,
+	})
+	collectors := []prometheus.Collector{
 		version.NewCollector(EXPORTER),
-		NewStatsCollector(*bindStats, *bindSh),
-	)
+		statsCollector,
+	}
+	if namedConf != nil {
+		collectors = append(collectors, NewConfigCollector(*bindConfig, *bindChroot))
+	}
+	rndcOpts := RndcOpts{Path: *bindRndc, Timeout: *rndcTimeout}
+	removeKeyFile := func() {}
+	if namedConf != nil && (*rndcStatus || *recursing || *zoneStatus || *dnssecStatus) {
+		remove, err := namedConf.RndcControl(&rndcOpts, "")
+		if err != nil {
+			log.Warn(err)
+		}
+		removeKeyFile = remove
+		removeOnSignal(removeKeyFile)
+	}
+	rndc := NewRndcRunner(rndcOpts)
+	if *rndcStatus {
+		collectors = append(collectors, NewRndcStatusCollector(rndc))
+	}
+	if *zoneStatus {
+		zones := zoneArgs(zoneStatusArg)
+		if len(zones) == 0 && namedConf != nil {
+			zones = statusZones(namedConf)
+		}
+		if len(zones) == 0 {
+			log.Warn("--collector.rndc-zonestatus is set, but there are no zones in named.conf or --collector.rndc-zonestatus.zone")
+		}
+		collectors = append(collectors, NewZoneStatusCollector(rndc, ZoneStatusOpts{
+			Zones:       zones,
+			Concurrency: *zoneStatusCon,
+			CacheTTL:    *zoneStatusTTL,
+		}))
+	}
+	if *dnssecStatus {
+		zones := zoneArgs(dnssecZoneArg)
+		if len(zones) == 0 && namedConf != nil {
+			zones = policyZones(namedConf)
+		}
+		if len(zones) == 0 {
+			log.Warn("--collector.rndc-dnssec is set, but there are no dnssec-policy zones in named.conf or --collector.rndc-dnssec.zone")
+		}
+		collectors = append(collectors, NewDNSSECStatusCollector(rndc, DNSSECStatusOpts{
+			Zones:       zones,
+			Concurrency: *zoneStatusCon,
+			CacheTTL:    *zoneStatusTTL,
+		}))
+	}
+	if *zoneFiles {
+		var zones []NamedZone
+		for _, arg := range zoneFileArgs {
+			zone, err := parseZoneFileArg(arg)
+			if err != nil {
+				log.Fatal(err)
+			}
+			zone.File = chrootPath(*bindChroot, zone.File)
+			zones = append(zones, zone)
+		}
+		if len(zones) == 0 && namedConf != nil {
+			zones = fileZones(namedConf)
+		}
+		if len(zones) == 0 {
+			log.Warn("--collector.zone-files is set, but there are no zone files in named.conf or --collector.zone-files.zone")
+		}
+		collectors = append(collectors, NewZoneFileCollector(zones))
+	}
+	if *disk {
+		opts := DiskOpts{}
+		for _, dir := range diskDirs {
+			opts.Dirs = append(opts.Dirs, chrootPath(*bindChroot, dir))
+		}
+		if len(opts.Dirs) == 0 {
+			if namedConf != nil && namedConf.Directory != "" {
+				opts.Dirs = append(opts.Dirs, namedConf.Path("."))
+			}
+			opts.Dirs = append(opts.Dirs, filepath.Dir(*bindStats))
+		}
+		if namedConf != nil {
+			opts.Zones = fileZones(namedConf)
+		}
+		collectors = append(collectors, NewDiskCollector(opts))
+	}
+	if *dnssecKeys {
+		dirs := make([]string, 0, len(dnssecKeyDirs))
+		for _, dir := range dnssecKeyDirs {
+			dirs = append(dirs, chrootPath(*bindChroot, dir))
+		}
+		if len(dirs) == 0 && namedConf != nil {
+			dirs = append(dirs, namedConf.KeyDirectoryPath())
+		}
+		if len(dirs) == 0 {
+			log.Warn("--collector.dnssec-keys is set, but there is no key directory in named.conf or --collector.dnssec-keys.dir")
+		}
+		collectors = append(collectors, NewDNSSECKeysCollector(dirs))
+	}
+	if *queryLog {
+		collector := NewQueryLogCollector(QueryLogOpts{
+			FilePath:     *queryLogFile,
+			TopN:         *queryLogTopN,
+			Capacity:     *queryLogCap,
+			IPv4Prefix:   *queryLogV4,
+			IPv6Prefix:   *queryLogV6,
+			SuffixLabels: *queryLogLbls,
+		})
+		go runEvery(time.Second, "Query log tail", collector.Poll)
+		collectors = append(collectors, collector)
+	}
+	if *namedLog {
+		rules, err := loadLogRules(*namedLogRules)
+		if err != nil {
+			log.Fatal(err)
+		}
+		collector := NewLogCollector(*namedLogFile, rules)
+		go runEvery(time.Second, "Log tail", collector.Poll)
+		collectors = append(collectors, collector)
+	}
+	if *dnstapOn {
+		var views []dnstapView
+		for _, arg := range dnstapViews {
+			view, err := parseDNSTapView(arg)
+			if err != nil {
+				log.Fatal(err)
+			}
+			views = append(views, view)
+		}
+		collector := NewDNSTapCollector(views)
+		if err := collector.Listen(*dnstapSocket); err != nil {
+			log.Fatal(err)
+		}
+		collectors = append(collectors, collector)
+	}
+	if len(probeArgs) > 0 {
+		opts := ProbeOpts{
+			Server:      *probeServer,
+			TLSServer:   *probeTLS,
+			TLSInsecure: *probeInsecure,
+			Timeout:     *probeTimeout,
+		}
+		probes, err := parseDNSProbes(probeArgs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts.Probes = probes
+		collectors = append(collectors, NewProbeCollector(opts))
+	}
+	var recursingCollector *recursingCollector
+	if *recursing {
+		recursingCollector = NewRecursingCollector(rndc, RecursingOpts{
+			FilePath: *recursingFile,
+			TopN:     *recursingTopN,
+		})
+		collectors = append(collectors, recursingCollector)
+	}
 	if *bindPidFile != "" {
 		procExporter := prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{
 			PidFn: func() (int, error) {
@@ -59,11 +351,133 @@ func main() {
 			},
 			Namespace: namespace,
 		})
-		prometheus.MustRegister(procExporter)
+		collectors = append(collectors, procExporter)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors...)
+
+	var senders []func()
+	if *pushURL != "" {
+		if *bindTimestamp {
+			log.Fatal("--bind.stats-timestamp can't be used with --push.url, the Pushgateway rejects samples with timestamps")
+		}
+		if _, ok := pushGrouping["instance"]; !ok {
+			pushGrouping["instance"] = hostname
+		}
+		pusher, err := NewStatsPusher(PushOpts{
+			URL:          *pushURL,
+			Job:          *pushJob,
+			Grouping:     pushGrouping,
+			Username:     *pushUsername,
+			PasswordFile: *pushPassword,
+			Retries:      *pushRetries,
+			RetryBackoff: *pushBackoff,
+		}, registry)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Info("Pushing to ", *pushURL, " every ", *pushInterval)
+		senders = append(senders, func() { runEvery(*pushInterval, "Push", pusher.Push) })
+	}
+	if *rwURL != "" {
+		if _, ok := rwLabels["job"]; !ok {
+			rwLabels["job"] = "bind"
+		}
+		if _, ok := rwLabels["instance"]; !ok {
+			rwLabels["instance"] = hostname
+		}
+		writer, err := NewRemoteWriter(RemoteWriteOpts{
+			URL:            *rwURL,
+			Username:       *rwUsername,
+			PasswordFile:   *rwPassword,
+			Timeout:        *rwTimeout,
+			ExternalLabels: rwLabels,
+			QueueSize:      *rwQueueSize,
+			QueueDir:       *rwQueueDir,
+		}, registry)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Info("Writing to ", *rwURL, " every ", *rwInterval)
+		senders = append(senders, func() { runEvery(*rwInterval, "Remote write", writer.Send) })
+	}
+	if *otlpEndpoint != "" {
+		if *otlpInstance == "" {
+			*otlpInstance = hostname
+		}
+		for name, value := range map[string]string{
+			"host.name":           hostname,
+			"service.instance.id": *otlpInstance,
+			"service.name":        EXPORTER,
+			"service.version":     version.Version,
+		} {
+			if _, ok := otlpResource[name]; !ok {
+				otlpResource[name] = value
+			}
+		}
+		exporter, err := NewOTLPExporter(OTLPOpts{
+			Endpoint:           *otlpEndpoint,
+			Protocol:           *otlpProtocol,
+			Insecure:           *otlpInsecure,
+			Timeout:            *otlpTimeout,
+			Headers:            otlpHeaders,
+			ResourceAttributes: otlpResource,
+		}, registry)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Info("Exporting over OTLP/", *otlpProtocol, " to ", *otlpEndpoint, " every ", *otlpInterval)
+		senders = append(senders, func() { runEvery(*otlpInterval, "OTLP export", exporter.Export) })
+	}
+	for _, output := range []struct {
+		name     string
+		target   string
+		interval time.Duration
+		encode   statsEncoder
+	}{
+		{"InfluxDB output", *influxOutput, *influxIntvl, EncodeInflux},
+		{"Graphite output", *graphiteOut, *graphiteIntvl, EncodeGraphite},
+	} {
+		if output.target == "" {
+			continue
+		}
+		out, err := NewStatsOutput(output.target, hostname, output.encode, statsCollector.scrape)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Info("Writing ", output.name, " to ", output.target, " every ", output.interval)
+		name, interval := output.name, output.interval
+		senders = append(senders, func() { runEvery(interval, name, out.Write) })
+	}
+	if *textfileOut != "" {
+		if *bindTimestamp {
+			log.Fatal("--bind.stats-timestamp can't be used with --textfile.output, the textfile collector rejects samples with timestamps")
+		}
+		if !strings.HasSuffix(*textfileOut, ".prom") {
+			log.Warn("The textfile collector only reads files ending in .prom, ", *textfileOut, " will be ignored")
+		}
+		log.Info("Writing textfile ", *textfileOut, " every ", *textfileIntvl)
+		senders = append(senders, func() { writeTextfile(*textfileOut, *textfileIntvl, registry, nil) })
+	}
+	if len(senders) > 0 {
+		for _, send := range senders[1:] {
+			go send()
+		}
+		senders[0]()
 	}
 
+	prometheus.MustRegister(collectors...)
+
 	log.Info("Starting Server: ", *listenAddress)
 	http.Handle(*metricsPath, promhttp.Handler())
+	if recursingCollector != nil {
+		http.Handle("/debug/recursing", recursingCollector)
+	}
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`<html>
              <head><title>Bind Stats Exporter</title></head>
@@ -73,5 +487,42 @@ func main() {
              </body>
              </html>`))
 	})
-	log.Fatal(http.ListenAndServe(*listenAddress, nil))
+	err = http.ListenAndServe(*listenAddress, nil)
+	removeKeyFile()
+	log.Fatal(err)
+}
+
+// removeOnSignal calls remove and exits when the exporter is interrupted or
+// terminated, so temporary files don't outlive it.
+func removeOnSignal(remove func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Infof("Received %s, exiting", sig)
+		remove()
+		os.Exit(0)
+	}()
+}
+
+// runEvery calls fn right away and then once per interval, forever.
+func runEvery(interval time.Duration, name string, fn func() error) {
+	runUntil(nil, interval, name, fn)
+}
+
+// runUntil calls fn right away and then once per interval, until stop is
+// closed. A nil stop runs forever.
+func runUntil(stop <-chan struct{}, interval time.Duration, name string, fn func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := fn(); err != nil {
+			log.Errorf("%s failed: %s", name, err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
 }